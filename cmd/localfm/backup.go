@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+// runBackup implements "localfm backup"
+func runBackup(db *m.Database, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	dir := flags.String("dir", filepath.Dir(db.Path), "Directory to write snapshots to")
+	keep := flags.Int("keep", 7, "Number of snapshots to keep, 0 keeps all of them")
+	flags.Parse(args)
+
+	res, err := db.Backup(*dir, *keep)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s (%d pages)\n", res.Path, res.Pages)
+	for _, path := range res.Removed {
+		fmt.Printf("removed %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+// runDoctor implements "localfm doctor"
+func runDoctor(db *m.Database, args []string) error {
+	report, err := db.Doctor()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("checked %d activity rows\n", report.ActivityCount)
+	if len(report.Findings) == 0 {
+		fmt.Println("no problems found")
+		return nil
+	}
+
+	errorCount := 0
+	for _, f := range report.Findings {
+		if f.Severity == m.SeverityError {
+			errorCount++
+		}
+		fmt.Printf("\n[%s] %s: %s\n", f.Severity, f.Check, f.Problem)
+		fmt.Printf("  fix: %s\n", f.Fix)
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("%d errors found", errorCount)
+	}
+	return nil
+}
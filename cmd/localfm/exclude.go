@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+const excludeUsage = `usage:
+  localfm exclude list
+  localfm exclude add [-artist NAME | -album NAME | -title PATTERN]
+  localfm exclude remove ID
+
+artist and album names match exactly (ignoring case), title
+patterns use sql LIKE syntax, e.g. -title '%podcast%'
+`
+
+// runExclude implements "localfm exclude"
+func runExclude(db *m.Database, args []string) error {
+	if len(args) == 0 {
+		io.WriteString(os.Stderr, excludeUsage)
+		return errors.New("missing exclude subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		exclusions, err := db.ListExclusions()
+		if err != nil {
+			return err
+		}
+		for _, ex := range exclusions {
+			fmt.Printf("%d\t%s\t%s\n", ex.ID, ex.Kind, ex.Pattern)
+		}
+		return nil
+
+	case "add":
+		flags := flag.NewFlagSet("exclude add", flag.ExitOnError)
+		artist := flags.String("artist", "", "Artist name to exclude")
+		album := flags.String("album", "", "Album name to exclude")
+		title := flags.String("title", "", "Track title pattern to exclude")
+		flags.Parse(args[1:])
+
+		var kind, pattern string
+		switch {
+		case *artist != "":
+			kind, pattern = "artist", *artist
+		case *album != "":
+			kind, pattern = "album", *album
+		case *title != "":
+			kind, pattern = "title", *title
+		default:
+			return errors.New("one of -artist, -album or -title is required")
+		}
+
+		ex, err := db.AddExclusion(kind, pattern)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d\t%s\t%s\n", ex.ID, ex.Kind, ex.Pattern)
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return errors.New("remove takes a single exclusion id")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid exclusion id: %s", args[1])
+		}
+		return db.RemoveExclusion(id)
+
+	default:
+		io.WriteString(os.Stderr, excludeUsage)
+		return fmt.Errorf("unknown exclude subcommand: %s", args[0])
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+	"bitbucket.org/grgbrn/localfm/pkg/util"
+)
+
+const usage = `usage: localfm <command> [arguments]
+
+commands:
+  backup     write a verified snapshot of the database
+  doctor     check the database for integrity and data quality problems
+  exclude    manage the list of music left out of statistics
+  rollup     rebuild or check the pre-aggregated play counts
+`
+
+// main entry point for the localfm admin command, which groups
+// maintenance tasks that work directly on the database
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	//
+	// database init
+	//
+	db, err := m.Open(util.MustGetEnvStr("DSN"))
+	if err != nil {
+		panic(err)
+	}
+
+	switch cmd {
+	case "backup":
+		err = runBackup(db, args)
+	case "doctor":
+		err = runDoctor(db, args)
+	case "exclude":
+		err = runExclude(db, args)
+	case "rollup":
+		err = runRollup(db, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", cmd)
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
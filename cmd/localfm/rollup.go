@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+const rollupUsage = `usage:
+  localfm rollup rebuild   recompute the rollup tables from scratch
+  localfm rollup check     compare the rollup tables against raw activity
+`
+
+// runRollup implements "localfm rollup"
+func runRollup(db *m.Database, args []string) error {
+	if len(args) != 1 {
+		io.WriteString(os.Stderr, rollupUsage)
+		return errors.New("missing rollup subcommand")
+	}
+
+	switch args[0] {
+	case "rebuild":
+		start := time.Now()
+		err := db.RebuildRollups()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rebuilt rollups in %v\n", time.Since(start))
+		return nil
+
+	case "check":
+		var first int64
+		err := db.SQL.QueryRow(`SELECT coalesce(min(uts), 0) FROM activity`).Scan(&first)
+		if err != nil {
+			return err
+		}
+		if first == 0 {
+			fmt.Println("database is empty, nothing to check")
+			return nil
+		}
+
+		problems, err := query.VerifyRollups(db.SQL, time.Unix(first, 0).UTC(), time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d mismatches found, run \"localfm rollup rebuild\"", len(problems))
+		}
+		fmt.Println("rollups match activity")
+		return nil
+
+	default:
+		io.WriteString(os.Stderr, rollupUsage)
+		return fmt.Errorf("unknown rollup subcommand: %s", args[0])
+	}
+}
@@ -17,9 +17,37 @@ func main() {
 
 	delayPtr := flag.Int("delay", 5, "Delay in seconds between API calls")
 	limitPtr := flag.Int("limit", 0, "Limit number of API calls")
+	fromPtr := flag.String("from", "", "Refetch scrobbles from this UTC day (YYYY-MM-DD)")
+	toPtr := flag.String("to", "", "Refetch scrobbles up to and including this UTC day (YYYY-MM-DD)")
 
 	flag.Parse()
 
+	// a resync fills in a range that's been missed, instead
+	// of fetching everything since the last update
+	var from, to int64
+	if *fromPtr != "" || *toPtr != "" {
+		if *fromPtr == "" || *toPtr == "" {
+			fmt.Fprintln(os.Stderr, "-from and -to must be used together")
+			os.Exit(2)
+		}
+		fromDay, err := time.Parse("2006-01-02", *fromPtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bad -from date: %v\n", err)
+			os.Exit(2)
+		}
+		toDay, err := time.Parse("2006-01-02", *toPtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bad -to date: %v\n", err)
+			os.Exit(2)
+		}
+		if toDay.Before(fromDay) {
+			fmt.Fprintln(os.Stderr, "-to must not be before -from")
+			os.Exit(2)
+		}
+		from = fromDay.Unix()
+		to = toDay.AddDate(0, 0, 1).Unix()
+	}
+
 	//
 	// create logger
 	//
@@ -64,6 +92,8 @@ func main() {
 		update.FetchOptions{
 			APIThrottleDelay: delay,
 			RequestLimit:     *limitPtr,
+			From:             from,
+			To:               to,
 		},
 	)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -101,6 +102,19 @@ func main() {
 		}()
 	}
 
+	backupFreq := os.Getenv("BACKUP_FREQUENCY_HOURS")
+	if backupFreq != "" {
+		i, err := strconv.Atoi(backupFreq)
+		if err != nil {
+			panic(fmt.Sprintf("Error parsing BACKUP_FREQUENCY_HOURS as an int: %s", backupFreq))
+		}
+		if i <= 0 {
+			infoLog.Println("BACKUP_FREQUENCY_HOURS is 0 or less, periodic backups are disabled")
+		} else {
+			startBackups(db, time.Duration(i)*time.Hour, infoLog, errorLog)
+		}
+	}
+
 	// create & run the webserver on the main goroutine
 	addr := fmt.Sprintf(":%d", util.GetEnvInt("PORT", 4000))
 	srv := &http.Server{
@@ -113,3 +127,30 @@ func main() {
 	err = srv.ListenAndServe()
 	errorLog.Fatal(err)
 }
+
+// startBackups starts a goroutine that periodically snapshots the
+// database. the backup api makes this safe even while an update is running
+func startBackups(db *model.Database, freq time.Duration, infoLog, errorLog *log.Logger) {
+	ticker := time.NewTicker(freq)
+
+	backupDir := util.GetEnvStr("BACKUP_DIR", filepath.Dir(db.Path))
+	backupKeep := util.GetEnvInt("BACKUP_KEEP", 7)
+
+	go func() {
+		infoLog.Printf("Starting periodic backups to %s every %v\n", backupDir, freq)
+
+		for {
+			<-ticker.C
+
+			res, err := db.Backup(backupDir, backupKeep)
+			if err != nil {
+				errorLog.Printf("Backup failed: %v\n", err)
+				continue
+			}
+			infoLog.Printf("Backup written to %s\n", res.Path)
+			for _, path := range res.Removed {
+				infoLog.Printf("Removed old backup %s\n", path)
+			}
+		}
+	}()
+}
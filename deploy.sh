@@ -15,11 +15,15 @@ mkdir -p $STATICDIR
 # build all binaries
 export GOOS=linux
 export GOARCH=amd64
+# search needs sqlite built with full text search support
+export GOFLAGS="-tags=sqlite_fts5"
 
 echo "building web"
 go build -o $BINDIR ./cmd/web/
 echo "building update"
 go build -o $BINDIR ./cmd/update/
+echo "building localfm"
+go build -o $BINDIR ./cmd/localfm/
 
 echo "copying ui files"
 cp -R ui $STATICDIR
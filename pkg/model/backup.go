@@ -0,0 +1,190 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/util"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backup files are named after the database with a utc timestamp,
+// so sorting them by name also sorts them by age
+const backupTimeFormat = "20060102T150405Z"
+
+// BackupResult describes a completed backup
+type BackupResult struct {
+	Path    string
+	Pages   int
+	Removed []string // older snapshots deleted by the retention policy
+}
+
+// Backup writes a timestamped snapshot of the database into dir using
+// sqlite's online backup api, which is safe to run while other
+// connections are writing. The snapshot is checked with
+// "PRAGMA integrity_check" and only then are snapshots beyond the
+// newest keep deleted. keep <= 0 keeps everything
+func (db *Database) Backup(dir string, keep int) (BackupResult, error) {
+	var res BackupResult
+
+	base := strings.TrimSuffix(filepath.Base(db.Path), filepath.Ext(db.Path))
+	res.Path = filepath.Join(dir, fmt.Sprintf("%s-%s.db", base, time.Now().UTC().Format(backupTimeFormat)))
+
+	if util.FileExists(res.Path) {
+		return res, fmt.Errorf("backup %s already exists", res.Path)
+	}
+
+	pages, err := db.copyTo(res.Path)
+	if err != nil {
+		os.Remove(res.Path)
+		return res, err
+	}
+	res.Pages = pages
+
+	err = verifyBackup(res.Path)
+	if err != nil {
+		// don't leave a bad snapshot around to be mistaken for a good one,
+		// and don't touch the older ones
+		os.Remove(res.Path)
+		return res, err
+	}
+
+	if keep > 0 {
+		res.Removed, err = pruneBackups(dir, base, keep)
+	}
+	return res, err
+}
+
+// copyTo copies the whole database to a new file, returning the page count
+func (db *Database) copyTo(path string) (int, error) {
+	ctx := context.Background()
+	var pages int
+
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return pages, err
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return pages, err
+	}
+	defer destConn.Close()
+
+	srcConn, err := db.SQL.Conn(ctx)
+	if err != nil {
+		return pages, err
+	}
+	defer srcConn.Close()
+
+	// the backup api works on raw driver connections
+	err = destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			destSQLite, ok := destDriver.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup destination isn't a sqlite connection")
+			}
+			srcSQLite, ok := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup source isn't a sqlite connection")
+			}
+
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+
+			// copy everything in one step. if another connection writes
+			// to the database part way through, sqlite restarts the copy
+			done, err := b.Step(-1)
+			pages = b.PageCount()
+			if err == nil && !done {
+				err = errors.New("backup did not complete")
+			}
+			if err != nil {
+				b.Close()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+	return pages, err
+}
+
+// verifyBackup runs sqlite's integrity check on a snapshot
+func verifyBackup(path string) error {
+	snapshot, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	rows, err := snapshot.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// a healthy database returns a single "ok" row,
+	// otherwise each row describes a problem
+	var problems []string
+	for rows.Next() {
+		var msg string
+		err = rows.Scan(&msg)
+		if err != nil {
+			return err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("backup %s failed integrity check: %s", path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// pruneBackups deletes all but the newest keep snapshots of a database
+func pruneBackups(dir, base string, keep int) ([]string, error) {
+	var removed []string
+
+	matches, err := filepath.Glob(filepath.Join(dir, base+"-*.db"))
+	if err != nil {
+		return removed, err
+	}
+
+	// ignore anything that happens to match the glob but
+	// doesn't have a valid timestamp
+	var snapshots []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), base+"-"), ".db")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			snapshots = append(snapshots, m)
+		}
+	}
+	if len(snapshots) <= keep {
+		return removed, nil
+	}
+
+	sort.Strings(snapshots)
+	for _, path := range snapshots[:len(snapshots)-keep] {
+		err = os.Remove(path)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDB creates a database from the initial schema in a new
+// directory and opens it. The returned func removes the directory
+func newTestDB(t *testing.T) (*Database, string, func()) {
+	dir, err := ioutil.TempDir("", "localfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	schema, err := ioutil.ReadFile("../../scripts/schema.sql")
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.db")
+	raw, err := sql.Open("sqlite3", path)
+	if err == nil {
+		_, err = raw.Exec(string(schema))
+		raw.Close()
+	}
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	db, err := Open("sqlite://" + path)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return db, dir, func() {
+		db.SQL.Close()
+		cleanup()
+	}
+}
+
+// storeTracks stores a play of a track by artist at each of times
+func storeTracks(t *testing.T, db *Database, artist string, times ...time.Time) {
+	var tracks []TrackInfo
+	for _, when := range times {
+		var ti TrackInfo
+		ti.Artist.Name = artist
+		ti.Name = "Track " + strconv.Itoa(len(tracks))
+		ti.Album.Name = "Album"
+		ti.Date.Uts = strconv.FormatInt(when.Unix(), 10)
+		tracks = append(tracks, ti)
+	}
+	err := db.StoreActivity(tracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	db, dir, cleanup := newTestDB(t)
+	defer cleanup()
+
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	storeTracks(t, db, "Low", start, start.Add(5*time.Minute), start.Add(10*time.Minute))
+
+	backups := filepath.Join(dir, "backups")
+	err := os.Mkdir(backups, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// older snapshots, and a file that isn't one
+	for _, name := range []string{
+		"test-20220101T000000Z.db", "test-20200101T000000Z.db",
+		"test-20210101T000000Z.db", "test-copy.db",
+	} {
+		err = ioutil.WriteFile(filepath.Join(backups, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := db.Backup(backups, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(res.Path), "test-"), ".db")
+	if _, err := time.Parse(backupTimeFormat, stamp); err != nil || filepath.Dir(res.Path) != backups {
+		t.Errorf("backup is named %s", res.Path)
+	}
+	if res.Pages == 0 {
+		t.Error("backup copied no pages")
+	}
+
+	// the oldest snapshots go, the newest and anything else stay
+	removed := []string{
+		filepath.Join(backups, "test-20200101T000000Z.db"),
+		filepath.Join(backups, "test-20210101T000000Z.db"),
+	}
+	if strings.Join(res.Removed, " ") != strings.Join(removed, " ") {
+		t.Errorf("removed %v, want %v", res.Removed, removed)
+	}
+	left, err := filepath.Glob(filepath.Join(backups, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(backups, "test-20220101T000000Z.db"),
+		filepath.Join(backups, "test-copy.db"),
+		res.Path,
+	}
+	sort.Strings(left)
+	sort.Strings(want)
+	if strings.Join(left, " ") != strings.Join(want, " ") {
+		t.Errorf("left %v, want %v", left, want)
+	}
+
+	// the snapshot is a copy of the database
+	snapshot, err := sql.Open("sqlite3", res.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+	var plays int
+	err = snapshot.QueryRow(`SELECT count(*) FROM activity`).Scan(&plays)
+	if err != nil || plays != 3 {
+		t.Errorf("snapshot has %d plays, %v", plays, err)
+	}
+}
+
+func TestPruneBackupsKeepsEverything(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"test-20200101T000000Z.db", "test-20210101T000000Z.db"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := pruneBackups(dir, "test", 2)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("keeping as many as there are removed %v, %v", removed, err)
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	db, dir, cleanup := newTestDB(t)
+	defer cleanup()
+
+	if err := verifyBackup(db.Path); err != nil {
+		t.Errorf("a good database failed the check: %v", err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.db")
+	header := make([]byte, 4096)
+	copy(header, "SQLite format 3\x00")
+	err := ioutil.WriteFile(corrupt, append(header, []byte(strings.Repeat("garbage", 1000))...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBackup(corrupt); err == nil {
+		t.Error("a corrupt database passed the check")
+	}
+}
@@ -83,10 +83,24 @@ func Open(DSN string) (*Database, error) {
 		return nil, err
 	}
 
-	return &Database{
+	database := &Database{
 		SQL:  db,
 		Path: dbPath,
-	}, nil
+	}
+
+	// add any tables that are newer than the database
+	err = database.migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	// catch up on anything stored by a binary without search
+	err = database.updateSearchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return database, nil
 }
 
 // FindLatestTimestamp looks up the epoch time of the most recent db entry
@@ -116,6 +130,35 @@ func (db *Database) FindLatestTimestamp() (int64, error) {
 	return maxTime, nil
 }
 
+// FilterStored drops tracks that are already in the database, matched
+// by timestamp, artist and title, so refetching a range of scrobbles
+// that overlaps what's been downloaded doesn't store them twice
+func (db *Database) FilterStored(tracks []TrackInfo) ([]TrackInfo, error) {
+	stmt, err := db.SQL.Prepare(`SELECT count(*) FROM activity
+		WHERE uts = ? AND artist = ? AND title = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	unstored := make([]TrackInfo, 0, len(tracks))
+	for _, track := range tracks {
+		uts, err := GetParsedUTS(track)
+		if err != nil {
+			return nil, err
+		}
+		var count int
+		err = stmt.QueryRow(uts, track.Artist.Name, track.Name).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			unstored = append(unstored, track)
+		}
+	}
+	return unstored, nil
+}
+
 // StoreActivity inserts a list of activity records into the database
 // using a transaction. If error is returned the transaction was rolled
 // back and no rows were inserted; otherwise all were inserted
@@ -146,10 +189,17 @@ func (db *Database) StoreActivity(tracks []TrackInfo) error {
 	}
 	defer stmt.Close()
 
+	// declare everything up front so errors inside the loop aren't
+	// shadowed and always reach the rollback check below
 	var e error
 	var artist Artist
 	var album Album
 	var image Image
+	var uts int64
+	var dt time.Time
+	var res sql.Result
+	var activityID int64
+	var firstID int64 // range of new activity rows, for the rollups
 
 	for _, track := range tracks {
 
@@ -183,18 +233,18 @@ func (db *Database) StoreActivity(tracks []TrackInfo) error {
 			break
 		}
 
-		uts, e := GetParsedUTS(track)
+		uts, e = GetParsedUTS(track)
 		if e != nil {
 			fmt.Printf("error parsing UTS: %v\n", e)
 			break
 		}
-		dt, e := GetParsedTime(track)
+		dt, e = GetParsedTime(track)
 		if e != nil {
 			fmt.Printf("error parsing time: %v\n", e)
 			break
 		}
 
-		_, e = stmt.Exec(
+		res, e = stmt.Exec(
 			uts,
 			dt,
 			track.Name,
@@ -211,6 +261,35 @@ func (db *Database) StoreActivity(tracks []TrackInfo) error {
 			fmt.Println(e)
 			break
 		}
+
+		activityID, e = res.LastInsertId()
+		if e != nil {
+			fmt.Println("error reading activity row id")
+			fmt.Println(e)
+			break
+		}
+		if firstID == 0 {
+			firstID = activityID
+		}
+	}
+
+	// rows are only ever appended inside this transaction, so
+	// everything from firstID onwards is new
+	if e == nil && firstID != 0 {
+		e = updateRollups(tx, firstID, activityID)
+		if e != nil {
+			fmt.Println("error updating rollups")
+			fmt.Println(e)
+		}
+	}
+
+	// the search index doesn't update itself either
+	if e == nil && firstID != 0 {
+		e = indexActivity(tx)
+		if e != nil {
+			fmt.Println("error indexing activity")
+			fmt.Println(e)
+		}
 	}
 
 	fmt.Printf("done processing tracks. err=%v\n", e)
@@ -0,0 +1,292 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+
+database health checks
+
+none of these problems stop localfm from working, but they make the
+statistics less trustworthy. each finding comes with a suggested fix
+
+*/
+
+// Severity levels for doctor findings
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Finding is a single problem found by Doctor
+type Finding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Problem  string `json:"problem"`
+	Fix      string `json:"fix"`
+}
+
+// DoctorReport is the result of running all of the health checks
+type DoctorReport struct {
+	ActivityCount int       `json:"activityCount"`
+	CheckedAt     time.Time `json:"checkedAt"`
+	Findings      []Finding `json:"findings"`
+}
+
+func (r *DoctorReport) add(check, severity, fix, problem string, args ...interface{}) {
+	r.Findings = append(r.Findings, Finding{
+		Check:    check,
+		Severity: severity,
+		Problem:  fmt.Sprintf(problem, args...),
+		Fix:      fix,
+	})
+}
+
+// a run of empty days this long or shorter is treated as a failed
+// update rather than a real break from listening
+const maxSuspiciousGapDays = 7
+
+// Doctor checks the database for integrity and data quality problems
+func (db *Database) Doctor() (DoctorReport, error) {
+	report := DoctorReport{
+		CheckedAt: time.Now(),
+		Findings:  []Finding{},
+	}
+
+	err := db.SQL.QueryRow(`SELECT count(*) FROM activity`).Scan(&report.ActivityCount)
+	if err != nil {
+		return report, err
+	}
+
+	checks := []func(*DoctorReport) error{
+		db.checkForeignKeys,
+		db.checkImages,
+		db.checkMissingData,
+		db.checkGaps,
+	}
+	for _, check := range checks {
+		err = check(&report)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// checkForeignKeys finds activity rows pointing at artist, album or image
+// rows that don't exist. foreign keys aren't enforced by sqlite unless
+// they're turned on, but foreign_key_check works either way
+func (db *Database) checkForeignKeys(report *DoctorReport) error {
+	rows, err := db.SQL.Query(`PRAGMA foreign_key_check(activity)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var table, parent string
+		var rowid, fkid int64
+		err = rows.Scan(&table, &rowid, &parent, &fkid)
+		if err != nil {
+			return err
+		}
+		counts[parent]++
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	parents := make([]string, 0, len(counts))
+	for parent := range counts {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+
+	for _, parent := range parents {
+		report.add("foreign keys", SeverityError,
+			fmt.Sprintf("restore the missing %s rows from a backup, or find the rows with "+
+				"\"PRAGMA foreign_key_check(activity)\" and re-fetch them", parent),
+			"%d activity rows refer to a missing %s row", counts[parent], parent)
+	}
+
+	// foreign_key_check skips nulls, which are just as broken here
+	nullChecks := []struct{ column, parent string }{
+		{"artist_id", "artist"},
+		{"album_id", "album"},
+		{"image_id", "image"},
+	}
+	for _, nc := range nullChecks {
+		var n int
+		query := `SELECT count(*) FROM activity WHERE ` + nc.column + ` IS NULL`
+		err = db.SQL.QueryRow(query).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			report.add("foreign keys", SeverityError,
+				"these rows weren't stored by localfm, delete and re-fetch them",
+				"%d activity rows have no %s", n, nc.parent)
+		}
+	}
+	return nil
+}
+
+// checkImages finds unused image rows and images without a url
+func (db *Database) checkImages(report *DoctorReport) error {
+	var orphans int
+	query := `SELECT count(*) FROM image
+	WHERE id NOT IN (SELECT image_id FROM activity WHERE image_id IS NOT NULL)`
+	err := db.SQL.QueryRow(query).Scan(&orphans)
+	if err != nil {
+		return err
+	}
+	if orphans > 0 {
+		report.add("images", SeverityWarning,
+			"delete them with \"DELETE FROM image WHERE id NOT IN "+
+				"(SELECT image_id FROM activity WHERE image_id IS NOT NULL)\"",
+			"%d images aren't used by any activity", orphans)
+	}
+
+	var emptyImages, emptyPlays int
+	query = `SELECT count(*),
+	(SELECT count(*) FROM activity a JOIN image i ON a.image_id = i.id WHERE i.url = '')
+	FROM image WHERE url = ''`
+	err = db.SQL.QueryRow(query).Scan(&emptyImages, &emptyPlays)
+	if err != nil {
+		return err
+	}
+	if emptyImages > 0 {
+		report.add("images", SeverityInfo,
+			"last.fm had no artwork for these tracks when they were scrobbled, "+
+				"nothing to do unless artwork matters for them",
+			"%d image rows have an empty url, used by %d plays", emptyImages, emptyPlays)
+	}
+	return nil
+}
+
+// checkMissingData counts rows without albums or musicbrainz ids
+func (db *Database) checkMissingData(report *DoctorReport) error {
+	var noAlbum, noTrackMBID, noArtistMBID, noAlbumMBID int
+
+	query := `SELECT
+	coalesce(sum(album IS NULL OR album = ''), 0),
+	coalesce(sum(mbid IS NULL OR mbid = ''), 0)
+	FROM activity`
+	err := db.SQL.QueryRow(query).Scan(&noAlbum, &noTrackMBID)
+	if err != nil {
+		return err
+	}
+
+	err = db.SQL.QueryRow(`SELECT count(*) FROM artist WHERE mbid IS NULL`).Scan(&noArtistMBID)
+	if err != nil {
+		return err
+	}
+	err = db.SQL.QueryRow(`SELECT count(*) FROM album WHERE mbid IS NULL`).Scan(&noAlbumMBID)
+	if err != nil {
+		return err
+	}
+
+	if noAlbum > 0 {
+		report.add("missing data", SeverityInfo,
+			"fix the tags in your music player; album charts will skip these plays",
+			"%d plays have no album", noAlbum)
+	}
+	if noTrackMBID > 0 {
+		report.add("missing data", SeverityInfo,
+			"tag your files with MusicBrainz Picard so future scrobbles include ids",
+			"%d plays have no track MBID", noTrackMBID)
+	}
+	if noArtistMBID > 0 {
+		report.add("missing data", SeverityInfo,
+			"tag your files with MusicBrainz Picard so future scrobbles include ids",
+			"%d artists have no MBID", noArtistMBID)
+	}
+	if noAlbumMBID > 0 {
+		report.add("missing data", SeverityInfo,
+			"tag your files with MusicBrainz Picard so future scrobbles include ids",
+			"%d albums have no MBID", noAlbumMBID)
+	}
+	return nil
+}
+
+// checkGaps looks for short runs of days without any scrobbles between
+// two busy days, which usually means an update failed part way through.
+// days are utc days, since that's all the database knows about
+func (db *Database) checkGaps(report *DoctorReport) error {
+	query := `SELECT strftime('%Y-%m-%d', dt) AS day, count(*)
+	FROM activity
+	GROUP BY 1
+	ORDER BY 1`
+
+	rows, err := db.SQL.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type dayCount struct {
+		day   time.Time
+		count int
+	}
+	var days []dayCount
+	for rows.Next() {
+		var dayStr string
+		var dc dayCount
+		err = rows.Scan(&dayStr, &dc.count)
+		if err != nil {
+			return err
+		}
+		dc.day, err = time.Parse("2006-01-02", dayStr)
+		if err != nil {
+			return err
+		}
+		days = append(days, dc)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(days) < 3 {
+		return nil
+	}
+
+	// a "busy" day has at least as many plays as the median active day
+	counts := make([]int, len(days))
+	for i, dc := range days {
+		counts[i] = dc.count
+	}
+	sort.Ints(counts)
+	busy := counts[len(counts)/2]
+
+	// days only has rows for active days, so a gap is any pair of
+	// neighbours more than one day apart
+	for i := 1; i < len(days); i++ {
+		prev, next := days[i-1], days[i]
+		missing := int(next.day.Sub(prev.day).Hours()/24) - 1
+
+		if missing < 1 || missing > maxSuspiciousGapDays {
+			continue
+		}
+		if prev.count < busy || next.count < busy {
+			continue
+		}
+
+		first := prev.day.AddDate(0, 0, 1).Format("2006-01-02")
+		last := next.day.AddDate(0, 0, -1).Format("2006-01-02")
+		dayRange := first
+		if missing > 1 {
+			dayRange += ".." + last
+		}
+		report.add("gaps", SeverityWarning,
+			fmt.Sprintf("refetch them with \"update -from %s -to %s\" (check your "+
+				"last.fm profile first, this may be a real break)", first, last),
+			"no scrobbles on %s, between %s (%d plays) and %s (%d plays)",
+			dayRange, prev.day.Format("2006-01-02"), prev.count,
+			next.day.Format("2006-01-02"), next.count)
+	}
+	return nil
+}
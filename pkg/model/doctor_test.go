@@ -0,0 +1,110 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoctor(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// busy days have 5 plays, the median. march 5 and 6 are missing
+	// between two busy days, march 8 to 17 is too long to be a failed
+	// update and march 19 is next to a quiet day
+	plays := map[int]int{1: 5, 2: 5, 3: 1, 4: 5, 7: 5, 18: 5, 20: 1}
+	for day, n := range plays {
+		var times []time.Time
+		for i := 0; i < n; i++ {
+			times = append(times, time.Date(2024, time.March, day, 12, i, 0, 0, time.UTC))
+		}
+		storeTracks(t, db, "Low", times...)
+	}
+
+	// a play that wasn't stored by localfm, with no artist or image
+	// and an album that doesn't exist, and an image nothing uses
+	_, err := db.SQL.Exec(`INSERT INTO activity(uts, dt, title, artist, album_id)
+	VALUES (?, '2024-03-01 13:00:00', 'Words', 'Low', 999)`,
+		time.Date(2024, time.March, 1, 13, 0, 0, 0, time.UTC).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.SQL.Exec(`INSERT INTO image(url) VALUES ('http://img/orphan.jpg')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.Doctor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ActivityCount != 28 {
+		t.Errorf("checked %d plays, want 28", report.ActivityCount)
+	}
+
+	found := map[string][]Finding{}
+	for _, f := range report.Findings {
+		found[f.Check] = append(found[f.Check], f)
+	}
+
+	gaps := found["gaps"]
+	if len(gaps) != 1 {
+		t.Fatalf("found gaps %+v, want 1", gaps)
+	}
+	if gaps[0].Problem != "no scrobbles on 2024-03-05..2024-03-06, between 2024-03-04 (5 plays) and 2024-03-07 (5 plays)" ||
+		!strings.Contains(gaps[0].Fix, `"update -from 2024-03-05 -to 2024-03-06"`) {
+		t.Errorf("gap is %+v", gaps[0])
+	}
+
+	wantFK := []string{
+		"1 activity rows refer to a missing album row",
+		"1 activity rows have no artist",
+		"1 activity rows have no image",
+	}
+	var fk []string
+	for _, f := range found["foreign keys"] {
+		fk = append(fk, f.Problem)
+		if f.Severity != SeverityError {
+			t.Errorf("%s is a %s", f.Problem, f.Severity)
+		}
+	}
+	if strings.Join(fk, "; ") != strings.Join(wantFK, "; ") {
+		t.Errorf("foreign key problems are %v, want %v", fk, wantFK)
+	}
+
+	wantImages := []string{
+		"1 images aren't used by any activity",
+		"1 image rows have an empty url, used by 27 plays",
+	}
+	var images []string
+	for _, f := range found["images"] {
+		images = append(images, f.Problem)
+	}
+	if strings.Join(images, "; ") != strings.Join(wantImages, "; ") {
+		t.Errorf("image problems are %v, want %v", images, wantImages)
+	}
+}
+
+func TestDoctorHealthy(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// a week of listening, then a month off
+	var times []time.Time
+	for day := 1; day <= 7; day++ {
+		times = append(times, time.Date(2024, time.March, day, 12, 0, 0, 0, time.UTC))
+	}
+	times = append(times, time.Date(2024, time.April, 10, 12, 0, 0, 0, time.UTC))
+	storeTracks(t, db, "Low", times...)
+
+	report, err := db.Doctor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range report.Findings {
+		if f.Severity != SeverityInfo {
+			t.Errorf("%s: %s", f.Check, f.Problem)
+		}
+	}
+}
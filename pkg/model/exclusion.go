@@ -0,0 +1,149 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Exclusion is an entry on the list of music that's left out of
+// statistics. Excluded plays stay in the activity table, they just
+// aren't counted by the query package.
+//
+// Artist and album patterns match names exactly (ignoring case), title
+// patterns use sql LIKE syntax so "%podcast%" works as expected
+type Exclusion struct {
+	ID      int64  `json:"id"`
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+}
+
+// ExclusionKinds lists the valid values for Exclusion.Kind
+var ExclusionKinds = []string{"artist", "album", "title"}
+
+// ExcludedActivity is a sql expression that's true when an activity row
+// (aliased as "a") matches an entry in the exclusion table. Statistics
+// queries filter excluded plays out with "and not " + ExcludedActivity
+const ExcludedActivity = `exists (select 1 from exclusion x where
+	(x.kind = 'artist' and x.pattern = a.artist collate nocase) or
+	(x.kind = 'album' and x.pattern = a.album collate nocase) or
+	(x.kind = 'title' and a.title like x.pattern))`
+
+func validExclusionKind(kind string) bool {
+	for _, k := range ExclusionKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ListExclusions returns the whole exclusion list
+func (db *Database) ListExclusions() ([]Exclusion, error) {
+	var exclusions []Exclusion
+
+	query := `SELECT id, kind, pattern FROM exclusion ORDER BY kind, pattern`
+	rows, err := db.SQL.Query(query)
+	if err != nil {
+		return exclusions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ex := Exclusion{}
+		err = rows.Scan(&ex.ID, &ex.Kind, &ex.Pattern)
+		if err != nil {
+			return exclusions, err
+		}
+		exclusions = append(exclusions, ex)
+	}
+	return exclusions, rows.Err()
+}
+
+// AddExclusion adds a new entry to the exclusion list. Adding an entry
+// that already exists is not an error. This rebuilds the rollup tables
+// so it can take a few seconds on a large database
+func (db *Database) AddExclusion(kind, pattern string) (Exclusion, error) {
+	ex := Exclusion{
+		Kind:    kind,
+		Pattern: strings.TrimSpace(pattern),
+	}
+
+	if !validExclusionKind(kind) {
+		return ex, fmt.Errorf("invalid exclusion kind: %s", kind)
+	}
+	if ex.Pattern == "" {
+		return ex, fmt.Errorf("exclusion pattern can't be empty")
+	}
+
+	tx, err := db.SQL.Begin()
+	if err != nil {
+		return ex, err
+	}
+
+	insQuery := `INSERT INTO exclusion(kind, pattern) VALUES (?,?)
+	ON CONFLICT(kind, pattern) DO NOTHING`
+	_, err = tx.Exec(insQuery, ex.Kind, ex.Pattern)
+	if err != nil {
+		tx.Rollback()
+		return ex, err
+	}
+
+	// look up the id rather than trusting LastInsertId, which
+	// isn't set when the row already existed
+	selQuery := `SELECT id FROM exclusion WHERE kind=? AND pattern=?`
+	err = tx.QueryRow(selQuery, ex.Kind, ex.Pattern).Scan(&ex.ID)
+	if err != nil {
+		tx.Rollback()
+		return ex, err
+	}
+
+	err = exclusionsChanged(tx)
+	if err != nil {
+		tx.Rollback()
+		return ex, err
+	}
+	return ex, tx.Commit()
+}
+
+// RemoveExclusion deletes an entry from the exclusion list, and
+// rebuilds the rollup tables to count the newly included plays
+func (db *Database) RemoveExclusion(id int64) error {
+	tx, err := db.SQL.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`DELETE FROM exclusion WHERE id=?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("no exclusion with id %d", id)
+	}
+
+	err = exclusionsChanged(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// exclusionsChanged rebuilds the rollup tables after the exclusion list
+// has changed and bumps exclusion_version, which is how anything cached
+// from the activity finds out
+func exclusionsChanged(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE exclusion_version SET version = version + 1`)
+	if err != nil {
+		return err
+	}
+	return rebuildRollups(tx)
+}
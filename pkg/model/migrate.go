@@ -0,0 +1,159 @@
+package model
+
+import (
+	"fmt"
+)
+
+// migrations holds schema changes made after the initial schema in
+// scripts/schema.sql. They're applied in order when a database is opened
+// and the current version is tracked with sqlite's user_version pragma,
+// so a database created from schema.sql starts at version 0.
+//
+// Never edit an existing entry, only append new ones.
+var migrations = []string{
+	// 1: list of artists/albums/titles to leave out of statistics
+	`CREATE TABLE IF NOT EXISTS exclusion (
+		id INTEGER NOT NULL,
+		kind VARCHAR(16) NOT NULL, -- artist, album or title
+		pattern VARCHAR(255) NOT NULL,
+		PRIMARY KEY (id),
+		CONSTRAINT exclusion_unique UNIQUE (kind, pattern)
+	);`,
+
+	// 2: full text search index over activity, kept in sync by StoreActivity.
+	// requires go-sqlite3 to be built with -tags sqlite_fts5
+	`CREATE VIRTUAL TABLE IF NOT EXISTS activity_fts USING fts5(
+		artist, album, title,
+		content='activity', content_rowid='id'
+	);
+	INSERT INTO activity_fts(activity_fts) VALUES('rebuild');`,
+
+	// 3: daily/hourly rollup tables, kept in sync by StoreActivity
+	`CREATE TABLE IF NOT EXISTS rollup_artist_day (
+		day VARCHAR(10) NOT NULL, -- YYYY-MM-DD
+		artist VARCHAR(255) NOT NULL,
+		image_id INTEGER NOT NULL,
+		plays INTEGER NOT NULL,
+		PRIMARY KEY (day, artist, image_id)
+	);
+	CREATE TABLE IF NOT EXISTS rollup_track_day (
+		day VARCHAR(10) NOT NULL, -- YYYY-MM-DD
+		artist VARCHAR(255) NOT NULL,
+		title VARCHAR(255) NOT NULL,
+		image_id INTEGER NOT NULL,
+		plays INTEGER NOT NULL,
+		PRIMARY KEY (day, artist, title, image_id)
+	);
+	CREATE TABLE IF NOT EXISTS rollup_hour (
+		hour VARCHAR(16) NOT NULL, -- YYYY-MM-DD HH:00
+		plays INTEGER NOT NULL,
+		PRIMARY KEY (hour)
+	);
+	DELETE FROM rollup_artist_day;
+	DELETE FROM rollup_track_day;
+	DELETE FROM rollup_hour;
+	INSERT INTO rollup_artist_day(day, artist, image_id, plays)
+	SELECT strftime('%Y-%m-%d', a.dt), a.artist, coalesce(a.image_id, 0), count(*)
+	FROM activity a WHERE NOT exists (select 1 from exclusion x where
+		(x.kind = 'artist' and x.pattern = a.artist collate nocase) or
+		(x.kind = 'album' and x.pattern = a.album collate nocase) or
+		(x.kind = 'title' and a.title like x.pattern))
+	GROUP BY 1, 2, 3;
+	INSERT INTO rollup_track_day(day, artist, title, image_id, plays)
+	SELECT strftime('%Y-%m-%d', a.dt), a.artist, a.title, coalesce(a.image_id, 0), count(*)
+	FROM activity a WHERE NOT exists (select 1 from exclusion x where
+		(x.kind = 'artist' and x.pattern = a.artist collate nocase) or
+		(x.kind = 'album' and x.pattern = a.album collate nocase) or
+		(x.kind = 'title' and a.title like x.pattern))
+	GROUP BY 1, 2, 3, 4;
+	INSERT INTO rollup_hour(hour, plays)
+	SELECT strftime('%Y-%m-%d %H:00', a.dt), count(*)
+	FROM activity a WHERE NOT exists (select 1 from exclusion x where
+		(x.kind = 'artist' and x.pattern = a.artist collate nocase) or
+		(x.kind = 'album' and x.pattern = a.album collate nocase) or
+		(x.kind = 'title' and a.title like x.pattern))
+	GROUP BY 1;`,
+
+	// 4: tracks have no table of their own, they're looked up by artist
+	// and title. this also covers lookups by artist alone
+	`CREATE INDEX IF NOT EXISTS activity_artist_title ON activity (artist, title);`,
+
+	// 5: how far the search index has got through activity. databases that
+	// already have the index were kept in sync by StoreActivity
+	`CREATE TABLE IF NOT EXISTS search_index (
+		last_id INTEGER NOT NULL
+	);
+	INSERT INTO search_index(last_id)
+	SELECT CASE WHEN EXISTS (SELECT 1 FROM sqlite_master WHERE name = 'activity_fts')
+		THEN coalesce((SELECT max(id) FROM activity), 0)
+		ELSE 0 END;`,
+
+	// 6: utc hours don't line up with local hours in every timezone, so
+	// the hourly rollup is replaced by one per quarter hour (see
+	// QuarterHour). the uts index is for counting the partial days at
+	// either end of a date range straight from activity
+	`DROP TABLE IF EXISTS rollup_hour;
+	CREATE TABLE IF NOT EXISTS rollup_quarter_hour (
+		slot INTEGER NOT NULL, -- uts / 900
+		plays INTEGER NOT NULL,
+		PRIMARY KEY (slot)
+	);
+	INSERT INTO rollup_quarter_hour(slot, plays)
+	SELECT a.uts / 900, count(*)
+	FROM activity a WHERE NOT exists (select 1 from exclusion x where
+		(x.kind = 'artist' and x.pattern = a.artist collate nocase) or
+		(x.kind = 'album' and x.pattern = a.album collate nocase) or
+		(x.kind = 'title' and a.title like x.pattern))
+	GROUP BY 1;
+	CREATE INDEX IF NOT EXISTS activity_uts ON activity (uts);`,
+
+	// 7: a counter bumped whenever the exclusion list changes, so cached
+	// statistics can tell without checking every play against it
+	`CREATE TABLE IF NOT EXISTS exclusion_version (version INTEGER NOT NULL);
+	INSERT INTO exclusion_version(version) VALUES (0);`,
+}
+
+// fts5Migrations are the migrations that need fts5. Binaries built
+// without it skip them, and the search index is created later by
+// updateSearchIndex (see search.go) from wherever migration 5 says
+// indexing got to
+var fts5Migrations = map[int]bool{2: true}
+
+// SchemaVersion returns the number of migrations applied to the database
+func (db *Database) SchemaVersion() (int, error) {
+	var version int
+	err := db.SQL.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+// migrate brings the database schema up to date, applying each pending
+// migration in its own transaction
+func (db *Database) migrate() error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.SQL.Begin()
+		if err != nil {
+			return err
+		}
+		if searchAvailable || !fts5Migrations[i+1] {
+			_, err = tx.Exec(migrations[i])
+		}
+		if err == nil {
+			// pragmas can't take bound parameters
+			_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %v", i+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
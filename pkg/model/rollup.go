@@ -0,0 +1,98 @@
+package model
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+/*
+
+rollup tables
+
+play counts pre-aggregated by utc day (and by quarter hour for the
+listening clocks) so charts don't have to scan every activity row on each
+request. they're updated in the same transaction as StoreActivity, and
+excluded plays aren't counted so they're rebuilt whenever the exclusion
+list changes. the tables are created by the migrations in migrate.go
+
+image_id is part of each key so charts can still show every cover that
+was played. it's coalesced to 0 because nulls never conflict in a unique
+constraint, which would break the upserts
+
+*/
+
+// QuarterHour is the length in seconds of the rollup_quarter_hour slots.
+// Every timezone offset in use since last.fm started is a whole number
+// of quarter hours, so local hours and days always start on a slot
+// boundary and plays counted per slot add up to them exactly
+const QuarterHour = 900
+
+// rollupInserts returns statements that add the activity rows matching
+// a where clause to the rollup tables
+func rollupInserts(where string) []string {
+	filter := `WHERE (` + where + `) AND NOT ` + ExcludedActivity
+
+	return []string{
+		`INSERT INTO rollup_artist_day(day, artist, image_id, plays)
+		SELECT strftime('%Y-%m-%d', a.dt), a.artist, coalesce(a.image_id, 0), count(*)
+		FROM activity a ` + filter + `
+		GROUP BY 1, 2, 3
+		ON CONFLICT(day, artist, image_id) DO UPDATE SET plays = plays + excluded.plays`,
+
+		`INSERT INTO rollup_track_day(day, artist, title, image_id, plays)
+		SELECT strftime('%Y-%m-%d', a.dt), a.artist, a.title, coalesce(a.image_id, 0), count(*)
+		FROM activity a ` + filter + `
+		GROUP BY 1, 2, 3, 4
+		ON CONFLICT(day, artist, title, image_id) DO UPDATE SET plays = plays + excluded.plays`,
+
+		`INSERT INTO rollup_quarter_hour(slot, plays)
+		SELECT a.uts / ` + strconv.Itoa(QuarterHour) + `, count(*)
+		FROM activity a ` + filter + `
+		GROUP BY 1
+		ON CONFLICT(slot) DO UPDATE SET plays = plays + excluded.plays`,
+	}
+}
+
+// rebuildRollupsSQL clears the rollup tables and recomputes
+// them from the whole activity table
+func rebuildRollupsSQL() string {
+	stmts := []string{
+		`DELETE FROM rollup_artist_day`,
+		`DELETE FROM rollup_track_day`,
+		`DELETE FROM rollup_quarter_hour`,
+	}
+	stmts = append(stmts, rollupInserts("1")...)
+	return strings.Join(stmts, ";\n") + ";"
+}
+
+// updateRollups adds a range of newly inserted activity rows to the rollups
+func updateRollups(tx *sql.Tx, firstID, lastID int64) error {
+	for _, stmt := range rollupInserts(`a.id >= ? AND a.id <= ?`) {
+		_, err := tx.Exec(stmt, firstID, lastID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rebuildRollups(tx *sql.Tx) error {
+	_, err := tx.Exec(rebuildRollupsSQL())
+	return err
+}
+
+// RebuildRollups recomputes all of the rollup tables from scratch. This
+// shouldn't be needed in normal use, but is safe to run at any time
+func (db *Database) RebuildRollups() error {
+	tx, err := db.SQL.Begin()
+	if err != nil {
+		return err
+	}
+	err = rebuildRollups(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"errors"
+)
+
+/*
+
+full text search index
+
+search uses sqlite's fts5 extension, which go-sqlite3 only includes when
+it's built with -tags sqlite_fts5. binaries built without it never touch
+the index, so they can still open and update the database. the
+search_index table records the last activity row that was indexed, and
+anything added since is indexed the next time a binary with fts5 opens
+the database or stores activity
+
+*/
+
+// ErrSearchUnavailable is returned by searches when this binary was
+// built without fts5
+var ErrSearchUnavailable = errors.New("search unavailable: localfm was built without -tags sqlite_fts5")
+
+// SearchAvailable reports whether this binary can use the search index
+func SearchAvailable() bool {
+	return searchAvailable
+}
+
+// updateSearchIndex brings the search index up to date in its own
+// transaction. It does nothing without fts5
+func (db *Database) updateSearchIndex() error {
+	if !searchAvailable {
+		return nil
+	}
+
+	tx, err := db.SQL.Begin()
+	if err != nil {
+		return err
+	}
+	err = indexActivity(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,34 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package model
+
+import (
+	"database/sql"
+)
+
+const searchAvailable = true
+
+// indexActivity creates the search index if it doesn't exist yet and
+// adds every activity row that hasn't been indexed
+func indexActivity(tx *sql.Tx) error {
+	createIndex := `CREATE VIRTUAL TABLE IF NOT EXISTS activity_fts USING fts5(
+		artist, album, title,
+		content='activity', content_rowid='id'
+	);`
+	_, err := tx.Exec(createIndex)
+	if err != nil {
+		return err
+	}
+
+	addRows := `INSERT INTO activity_fts(rowid, artist, album, title)
+	SELECT id, artist, album, title FROM activity
+	WHERE id > (SELECT last_id FROM search_index);`
+	_, err = tx.Exec(addRows)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE search_index SET last_id = coalesce((SELECT max(id) FROM activity), last_id)`)
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build !sqlite_fts5
+// +build !sqlite_fts5
+
+package model
+
+import (
+	"database/sql"
+)
+
+const searchAvailable = false
+
+// indexActivity leaves the search index alone, since sqlite can't
+// read or write it without fts5
+func indexActivity(tx *sql.Tx) error {
+	return nil
+}
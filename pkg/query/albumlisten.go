@@ -0,0 +1,226 @@
+package query
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// album listens are runs of plays going through an album, something
+// per-track charts can't show. Scrobbles don't say which track of an
+// album was played, so "start to finish" means enough different tracks
+// from it in a row rather than every track in order
+
+// AlbumListenTracks is the fewest different tracks in a row from
+// one album that count as listening to the whole thing
+const AlbumListenTracks = 5
+
+// AlbumListenGap is the longest break allowed between two tracks
+// of an album listen
+const AlbumListenGap = 15 * time.Minute
+
+// when only the newest album listens are needed, plays are read back
+// from the end of the range this much at a time to begin with
+const albumListenWindow = 7 * 24 * time.Hour
+
+// AlbumListen is a single start to finish listen of an album. AlbumID
+// is the id of its first play, which is what AlbumHistory takes
+type AlbumListen struct {
+	AlbumID    int64     `json:"albumId"`
+	ArtistID   int64     `json:"artistId"`
+	Artist     string    `json:"artist"`
+	Album      string    `json:"album"`
+	ImageURL   string    `json:"url"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	TrackCount int       `json:"tracks"` // different tracks played
+}
+
+// AlbumListenCount is the number of album listens for one album
+type AlbumListenCount struct {
+	AlbumID  int64  `json:"albumId"`
+	ArtistID int64  `json:"artistId"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	ImageURL string `json:"url"`
+	Listens  int    `json:"listens"`
+}
+
+// ArtistListenCount is the number of album listens for one artist
+type ArtistListenCount struct {
+	ArtistID int64  `json:"artistId"`
+	Artist   string `json:"artist"`
+	Listens  int    `json:"listens"`
+}
+
+// AlbumListenStats summarizes the album listens in a date range
+type AlbumListenStats struct {
+	Count   int                 `json:"count"`
+	Listens []AlbumListen       `json:"listens"` // newest first
+	Albums  []AlbumListenCount  `json:"albums"`  // most listened first
+	Artists []ArtistListenCount `json:"artists"` // most listened first
+}
+
+// albumListens finds the album listens in a list of plays in time order.
+// A listen ends when the album changes, a track repeats or there's a
+// break longer than AlbumListenGap. Like TopAlbums, an album is an album
+// name played by a single artist
+func albumListens(plays []ActivityResult) []AlbumListen {
+	var listens []AlbumListen
+
+	first := 0
+	titles := map[string]bool{}
+	for i := 0; i <= len(plays); i++ {
+		if i > first && (i == len(plays) ||
+			plays[i].Artist != plays[first].Artist ||
+			plays[i].Album != plays[first].Album ||
+			plays[i].Time.Sub(plays[i-1].Time) > AlbumListenGap ||
+			titles[plays[i].Title]) {
+
+			if len(titles) >= AlbumListenTracks && plays[first].Album != "" {
+				listens = append(listens, newAlbumListen(plays[first:i]))
+			}
+			first = i
+			titles = map[string]bool{}
+		}
+		if i < len(plays) {
+			titles[plays[i].Title] = true
+		}
+	}
+	return listens
+}
+
+// newAlbumListen fills in an album listen from its plays
+func newAlbumListen(plays []ActivityResult) AlbumListen {
+	first := plays[0]
+	listen := AlbumListen{
+		AlbumID:    first.ID,
+		ArtistID:   first.ArtistID,
+		Artist:     first.Artist,
+		Album:      first.Album,
+		Start:      first.Time,
+		End:        plays[len(plays)-1].Time,
+		TrackCount: len(plays),
+	}
+	if len(first.ImageURLs) > 0 {
+		listen.ImageURL = first.ImageURLs[0]
+	}
+	return listen
+}
+
+// AlbumListens finds the album listens that start within a date range,
+// newest first. If limit is positive only the newest limit listens are
+// found, reading plays back from the end of the range a week at a time
+// (doubling each time) so a long range doesn't load all of its plays
+func AlbumListens(db *sql.DB, params DateRangeParams, limit int) ([]AlbumListen, error) {
+	listens := []AlbumListen{}
+
+	rangeStart := params.Start
+	window := params.End.Sub(params.Start)
+	if limit > 0 {
+		// "all" starts long before the first play
+		var first sql.NullInt64
+		err := db.QueryRow(`select min(uts) from activity`).Scan(&first)
+		if err != nil || !first.Valid {
+			return listens, err
+		}
+		if t := time.Unix(first.Int64, 0); t.After(rangeStart) {
+			rangeStart = t
+		}
+		if window > albumListenWindow {
+			window = albumListenWindow
+		}
+	}
+
+	for end := params.End; end.After(rangeStart); window *= 2 {
+		start := end.Add(-window)
+		if start.Before(rangeStart) {
+			start = rangeStart
+		}
+		found, err := albumListensStarting(db, params.TZ, start, end)
+		if err != nil {
+			return listens, err
+		}
+		listens = append(listens, found...)
+
+		if limit > 0 && len(listens) >= limit {
+			return listens[:limit], nil
+		}
+		end = start
+	}
+	return listens, nil
+}
+
+// albumListensStarting finds the album listens that start
+// between start and end, newest first
+func albumListensStarting(db *sql.DB, tz *time.Location, start, end time.Time) ([]AlbumListen, error) {
+	listens := []AlbumListen{}
+
+	// like sessions, listens at either end of the
+	// range can start before it or finish after it
+	from := start.Add(-maxSessionSpan).Unix()
+	to := end.Add(maxSessionSpan).Unix()
+	plays, err := activityPlays(db, tz, "a.uts >= ? and a.uts < ?", from, to)
+	if err != nil {
+		return listens, err
+	}
+
+	all := albumListens(plays)
+	for i := len(all) - 1; i >= 0; i-- {
+		l := all[i]
+		if !l.Start.Before(start) && l.Start.Before(end) {
+			listens = append(listens, l)
+		}
+	}
+	return listens, nil
+}
+
+// SummarizeAlbumListens counts album listens per album and per artist
+func SummarizeAlbumListens(listens []AlbumListen) AlbumListenStats {
+	stats := AlbumListenStats{
+		Count:   len(listens),
+		Listens: listens,
+		Albums:  []AlbumListenCount{},
+		Artists: []ArtistListenCount{},
+	}
+
+	// albums are an album name played by a single artist, as in TopAlbums
+	albums := map[string]int{}
+	artists := map[string]int{}
+	for _, l := range listens {
+		key := l.Artist + "\x00" + l.Album
+		if ix, ok := albums[key]; ok {
+			stats.Albums[ix].Listens++
+		} else {
+			albums[key] = len(stats.Albums)
+			stats.Albums = append(stats.Albums, AlbumListenCount{
+				AlbumID:  l.AlbumID,
+				ArtistID: l.ArtistID,
+				Artist:   l.Artist,
+				Album:    l.Album,
+				ImageURL: l.ImageURL,
+				Listens:  1,
+			})
+		}
+
+		if ix, ok := artists[l.Artist]; ok {
+			stats.Artists[ix].Listens++
+		} else {
+			artists[l.Artist] = len(stats.Artists)
+			stats.Artists = append(stats.Artists, ArtistListenCount{
+				ArtistID: l.ArtistID,
+				Artist:   l.Artist,
+				Listens:  1,
+			})
+		}
+	}
+
+	// stable, so ties stay most recent first
+	sort.SliceStable(stats.Albums, func(i, j int) bool {
+		return stats.Albums[i].Listens > stats.Albums[j].Listens
+	})
+	sort.SliceStable(stats.Artists, func(i, j int) bool {
+		return stats.Artists[i].Listens > stats.Artists[j].Listens
+	})
+	return stats
+}
@@ -0,0 +1,81 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAlbumListens(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// every ten days, two artists' albums with the same name back to
+	// back, which are separate listens even with no break between them
+	first := time.Date(2023, time.June, 1, 20, 0, 0, 0, time.UTC)
+	var plays []testPlay
+	for n := 0; n < 30; n++ {
+		start := first.AddDate(0, 0, n*10)
+		for i, artist := range []string{"Low", "Broadcast"} {
+			for track := 0; track < AlbumListenTracks; track++ {
+				plays = append(plays, testPlay{
+					uts:    start.Add(time.Duration(i*AlbumListenTracks+track) * 4 * time.Minute).Unix(),
+					artist: artist,
+					album:  "Greatest Hits",
+					title:  fmt.Sprintf("Track %d", track),
+				})
+			}
+		}
+	}
+	storePlays(t, db, plays)
+
+	now := first.AddDate(1, 0, 0)
+	ranges := []struct {
+		mode   string
+		offset int
+	}{
+		{"month", 3}, {"quarter", 1}, {"year", 0}, {"all", 0},
+	}
+	for _, r := range ranges {
+		mode := r.mode
+		params, err := NewDateRange(mode, r.offset, now, time.UTC, time.Sunday)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		all, err := AlbumListens(db.SQL, params, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) == 0 || len(all)%2 != 0 {
+			t.Errorf("%s: %d listens, want an even number", mode, len(all))
+		}
+		for i, l := range all {
+			if l.TrackCount != AlbumListenTracks {
+				t.Errorf("%s: listen of %s %s has %d tracks", mode, l.Artist, l.Album, l.TrackCount)
+			}
+			if i > 0 && l.Start.After(all[i-1].Start) {
+				t.Errorf("%s: listens aren't newest first", mode)
+			}
+		}
+
+		for _, limit := range []int{1, 5, 25, 100} {
+			newest, err := AlbumListens(db.SQL, params, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := all
+			if len(want) > limit {
+				want = want[:limit]
+			}
+			if fmt.Sprint(newest) != fmt.Sprint(want) {
+				t.Errorf("%s: newest %d listens are\n%v\nwant\n%v", mode, limit, newest, want)
+			}
+		}
+
+		stats := SummarizeAlbumListens(all)
+		if len(stats.Albums) != 2 || stats.Albums[0].Listens != len(all)/2 {
+			t.Errorf("%s: albums summarized as %v", mode, stats.Albums)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package query
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// PeriodCount is the number of plays in a single day or month,
+// which starts at Start in the user's timezone
+type PeriodCount struct {
+	Start     time.Time `json:"start"`
+	PlayCount int       `json:"count"`
+}
+
+// RankResult is an artist's position in the monthly artist chart.
+// Artists with the same number of plays share a rank
+type RankResult struct {
+	Start     time.Time `json:"start"`
+	Rank      int       `json:"rank"`
+	PlayCount int       `json:"count"`
+}
+
+// ArtistDetail is the complete listening history of a single artist
+type ArtistDetail struct {
+	ID         int64         `json:"id"`
+	Name       string        `json:"artist"`
+	ImageURL   string        `json:"url"`
+	TotalPlays int           `json:"count"`
+	FirstPlay  time.Time     `json:"firstPlay"`
+	LastPlay   time.Time     `json:"lastPlay"`
+	Monthly    []PeriodCount `json:"monthly"` // every month from first to last play
+	TopTracks  []TrackResult `json:"topTracks"`
+	TopAlbums  []AlbumResult `json:"topAlbums"`
+	Ranks      []RankResult  `json:"ranks"` // see ArtistRanks
+	TopDays    []PeriodCount `json:"topDays"`
+}
+
+// ArtistHistory collects everything known about the artist with the
+// given id. Months and days are calendar periods in tz, and limit caps
+// the number of top tracks, albums and days. Ranks are left empty, they
+// come from ArtistRanks. sql.ErrNoRows is returned if there is no such artist
+func ArtistHistory(db *sql.DB, id int64, tz *time.Location, limit int) (ArtistDetail, error) {
+	res := ArtistDetail{
+		ID:        id,
+		Monthly:   []PeriodCount{},
+		TopTracks: []TrackResult{},
+		TopAlbums: []AlbumResult{},
+		Ranks:     []RankResult{},
+		TopDays:   []PeriodCount{},
+	}
+
+	err := db.QueryRow(`select name from artist where id = ?`, id).Scan(&res.Name)
+	if err != nil {
+		return res, err
+	}
+
+	// activity rows carry the artist name, and the same name can have
+	// several artist rows, so everything below matches on the name
+	var first, last sql.NullInt64
+	var imageURL sql.NullString
+	query := `select count(*), min(a.uts), max(a.uts), min(i.url)
+	from activity a
+	left join image i on a.image_id = i.id
+	where a.artist = ?
+	and not ` + isExcluded + `;`
+
+	err = db.QueryRow(query, res.Name).Scan(&res.TotalPlays, &first, &last, &imageURL)
+	if err != nil {
+		return res, err
+	}
+	if res.TotalPlays == 0 {
+		return res, nil
+	}
+	res.FirstPlay = time.Unix(first.Int64, 0).In(tz)
+	res.LastPlay = time.Unix(last.Int64, 0).In(tz)
+	res.ImageURL = imageURL.String
+
+	plays, err := slotPlays(db, "a.artist = ?", res.Name)
+	if err != nil {
+		return res, err
+	}
+	res.Monthly = monthlyCounts(plays, tz)
+	res.TopDays = busiestDays(plays, tz, limit)
+
+	query = `select min(a.id), min(a.artist_id), a.artist, a.title, count(*) as plays, group_concat(distinct i.url)
+	from activity a
+	left join image i on a.image_id = i.id
+	where a.artist = ?
+	and not ` + isExcluded + `
+	group by a.artist, a.title
+	order by plays desc, a.title limit ?;`
+
+	res.TopTracks, err = scanTopTracks(db.Query(query, res.Name, limit))
+	if err != nil {
+		return res, err
+	}
+
+	query = `select min(a.id), a.artist, a.album, count(*) as plays, group_concat(distinct i.url)
+	from activity a
+	left join image i on a.image_id = i.id
+	where a.artist = ?
+	and a.album != ''
+	and not ` + isExcluded + `
+	group by a.artist, a.album
+	order by plays desc, a.album limit ?;`
+
+	res.TopAlbums, err = scanTopAlbums(db.Query(query, res.Name, limit))
+	return res, err
+}
+
+// ArtistRanks finds the chart position of an artist for
+// every month in which they were played, oldest first
+func ArtistRanks(months MonthlyArtists, artist string) []RankResult {
+	ranks := []RankResult{}
+
+	for month, artists := range months.months {
+		plays, ok := artists[artist]
+		if !ok {
+			continue
+		}
+		rank := 1
+		for _, n := range artists {
+			if n > plays {
+				rank++
+			}
+		}
+		ranks = append(ranks, RankResult{Start: month, Rank: rank, PlayCount: plays})
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		return ranks[i].Start.Before(ranks[j].Start)
+	})
+
+	return ranks
+}
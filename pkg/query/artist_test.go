@@ -0,0 +1,46 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArtistRanks(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// in india the last play is already in april
+	at := func(day, hour, min int) int64 {
+		return time.Date(2024, time.March, day, hour, min, 0, 0, time.UTC).Unix()
+	}
+	storePlays(t, db, []testPlay{
+		{uts: at(1, 12, 0), artist: "Low", title: "Words"},
+		{uts: at(2, 12, 0), artist: "Broadcast", title: "Echo's Answer"},
+		{uts: at(3, 12, 0), artist: "Broadcast", title: "Echo's Answer"},
+		{uts: at(31, 18, 40), artist: "Low", title: "Lazy"},
+	})
+
+	kolkata := loadZone(t, "Asia/Kolkata")
+	months, err := ArtistsByMonth(db.SQL, kolkata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranks := ArtistRanks(months, "Low")
+	want := []RankResult{
+		{Start: time.Date(2024, time.March, 1, 0, 0, 0, 0, kolkata), Rank: 2, PlayCount: 1},
+		{Start: time.Date(2024, time.April, 1, 0, 0, 0, 0, kolkata), Rank: 1, PlayCount: 1},
+	}
+	if len(ranks) != len(want) {
+		t.Fatalf("got ranks %+v, want %+v", ranks, want)
+	}
+	for i, r := range ranks {
+		if !r.Start.Equal(want[i].Start) || r.Rank != want[i].Rank || r.PlayCount != want[i].PlayCount {
+			t.Errorf("rank %d is %+v, want %+v", i, r, want[i])
+		}
+	}
+
+	if ranks := ArtistRanks(months, "Stereolab"); len(ranks) != 0 {
+		t.Errorf("an artist with no plays has ranks %+v", ranks)
+	}
+}
@@ -0,0 +1,157 @@
+package query
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// an artist time series follows the top artists of a date range through
+// it week by week or month by month, like the sparse histogram query in
+// scripts/query-scratch.sql but with the gaps filled in
+
+// ArtistSeries is the number of plays of one artist in each period of a
+// time series, or the running total up to the end of each period
+type ArtistSeries struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"artist"`
+	PlayCount int    `json:"count"` // over the whole date range
+	Counts    []int  `json:"counts"`
+}
+
+// ArtistTimeSeriesResult has the start of every period in a time series
+// and a series for each artist, in chart order
+type ArtistTimeSeriesResult struct {
+	Interval   string         `json:"interval"`
+	Cumulative bool           `json:"cumulative"`
+	Periods    []time.Time    `json:"periods"`
+	Artists    []ArtistSeries `json:"artists"`
+}
+
+// periodStart returns the start of the week, month or year containing t
+func periodStart(t time.Time, interval string, weekStart time.Weekday) time.Time {
+	switch interval {
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+	}
+	daysIn := (int(t.Weekday()) - int(weekStart) + 7) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysIn, 0, 0, 0, 0, t.Location())
+}
+
+// nextPeriod returns the start of the week, month or year after start
+func nextPeriod(start time.Time, interval string) time.Time {
+	switch interval {
+	case "month":
+		return start.AddDate(0, 1, 0)
+	case "year":
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 0, 7)
+}
+
+// ArtistTimeSeries counts plays of the top params.Limit artists of a
+// date range in every week or month of it, in params.TZ. Weeks start on
+// params.WeekStart, and the first and last periods only count plays
+// inside the range. An "all" range starts with the first play
+func ArtistTimeSeries(db *sql.DB, params DateRangeParams, interval string, cumulative bool) (ArtistTimeSeriesResult, error) {
+	res := ArtistTimeSeriesResult{
+		Interval: interval,
+		Periods:  []time.Time{},
+		Artists:  []ArtistSeries{},
+	}
+	if interval != "week" && interval != "month" {
+		return res, errors.New("invalid value for parameter: interval")
+	}
+
+	start := params.Start
+	first, ok, err := firstPlay(db)
+	if err != nil || !ok {
+		return res, err
+	}
+	if first.After(start) {
+		start = first
+	}
+
+	top, err := TopArtists(db, params)
+	if err != nil {
+		return res, err
+	}
+
+	index := map[time.Time]int{}
+	for p := periodStart(start.In(params.TZ), interval, params.WeekStart); p.Before(params.End); p = nextPeriod(p, interval) {
+		index[p] = len(res.Periods)
+		res.Periods = append(res.Periods, p)
+	}
+
+	artists := map[string]*ArtistSeries{}
+	for _, a := range top {
+		res.Artists = append(res.Artists, ArtistSeries{
+			ID:     a.ID,
+			Name:   a.Name,
+			Counts: make([]int, len(res.Periods)),
+		})
+	}
+	for i := range res.Artists {
+		artists[res.Artists[i].Name] = &res.Artists[i]
+	}
+
+	query := `select a.artist, ` + slotExpr + `, count(*)
+	from activity a
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `
+	group by 1, 2;`
+
+	rows, err := db.Query(query, params.Start.Unix(), params.End.Unix())
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var slot int64
+		var count int
+		err = rows.Scan(&name, &slot, &count)
+		if err != nil {
+			return res, err
+		}
+		a, ok := artists[name]
+		if !ok {
+			continue
+		}
+		when := slotTime(slot).In(params.TZ)
+		a.Counts[index[periodStart(when, interval, params.WeekStart)]] += count
+		a.PlayCount += count
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	if cumulative {
+		res = res.Accumulate()
+	}
+	return res, nil
+}
+
+// Accumulate turns per period counts into running totals
+func (res ArtistTimeSeriesResult) Accumulate() ArtistTimeSeriesResult {
+	if res.Cumulative {
+		return res
+	}
+
+	acc := res
+	acc.Cumulative = true
+	acc.Artists = make([]ArtistSeries, len(res.Artists))
+	for i, a := range res.Artists {
+		acc.Artists[i] = a
+		acc.Artists[i].Counts = make([]int, len(a.Counts))
+		total := 0
+		for j, count := range a.Counts {
+			total += count
+			acc.Artists[i].Counts[j] = total
+		}
+	}
+	return acc
+}
@@ -0,0 +1,258 @@
+package query
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// chart history is where every artist placed in the weekly, monthly and
+// yearly artist charts over all time. It takes a scan of every play to
+// work out, so callers should hold on to it until the ActivityVersion
+// changes
+
+// chartIntervals are the kinds of chart in a chart history
+var chartIntervals = []string{"week", "month", "year"}
+
+// ChartStats summarizes an artist's positions in one kind of chart.
+// Artists with the same number of plays share a rank, like RankResult
+type ChartStats struct {
+	Peak         int       `json:"peak"`      // best rank, 0 if never played
+	PeakStart    time.Time `json:"peakStart"` // first period at the peak
+	Charted      int       `json:"charted"`   // periods with any plays
+	TopTen       int       `json:"topTen"`
+	AtOne        int       `json:"atOne"`
+	LongestAtOne int       `json:"longestAtOne"` // consecutive periods at #1
+}
+
+// ArtistChartHistory is an artist's record in every kind of chart
+type ArtistChartHistory struct {
+	ID      int64      `json:"id"`
+	Name    string     `json:"artist"`
+	Weekly  ChartStats `json:"weekly"`
+	Monthly ChartStats `json:"monthly"`
+	Yearly  ChartStats `json:"yearly"`
+}
+
+// stats returns the chart stats for an interval
+func (h *ArtistChartHistory) stats(interval string) *ChartStats {
+	switch interval {
+	case "month":
+		return &h.Monthly
+	case "year":
+		return &h.Yearly
+	}
+	return &h.Weekly
+}
+
+// ChartHistory is the chart history of every artist that has been
+// played, with charts in a single timezone and week start
+type ChartHistory struct {
+	Version ActivityVersion
+	artists map[string]*ArtistChartHistory
+}
+
+// ActivityVersion changes whenever plays are added or the exclusion list
+// changes, so anything computed from all of the activity can be kept
+// until then. Plays are never deleted, so the newest id is enough to
+// tell when they've been added
+type ActivityVersion struct {
+	LastID     int64
+	Exclusions int64
+}
+
+// CurrentActivityVersion finds the current ActivityVersion
+func CurrentActivityVersion(db *sql.DB) (ActivityVersion, error) {
+	var v ActivityVersion
+	query := `select (select coalesce(max(id), 0) from activity),
+	(select version from exclusion_version);`
+	err := db.QueryRow(query).Scan(&v.LastID, &v.Exclusions)
+	return v, err
+}
+
+// NewChartHistory ranks every artist in every calendar week, month and
+// year in tz, with weeks starting on weekStart
+func NewChartHistory(db *sql.DB, tz *time.Location, weekStart time.Weekday) (ChartHistory, error) {
+	res := ChartHistory{artists: map[string]*ArtistChartHistory{}}
+
+	var err error
+	res.Version, err = CurrentActivityVersion(db)
+	if err != nil {
+		return res, err
+	}
+
+	query := `select a.artist, min(a.artist_id), ` + slotExpr + `, count(*)
+	from activity a
+	where not ` + isExcluded + `
+	group by a.artist, ` + slotExpr + `;`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	// plays per artist in each period of each interval
+	counts := map[string]map[time.Time]map[string]int{}
+	for _, interval := range chartIntervals {
+		counts[interval] = map[time.Time]map[string]int{}
+	}
+
+	for rows.Next() {
+		var name string
+		var id, slot int64
+		var count int
+		err = rows.Scan(&name, &id, &slot, &count)
+		if err != nil {
+			return res, err
+		}
+
+		artist, ok := res.artists[name]
+		if !ok {
+			artist = &ArtistChartHistory{ID: id, Name: name}
+			res.artists[name] = artist
+		}
+		if id < artist.ID {
+			artist.ID = id
+		}
+
+		t := slotTime(slot).In(tz)
+		for _, interval := range chartIntervals {
+			p := periodStart(t, interval, weekStart)
+			if counts[interval][p] == nil {
+				counts[interval][p] = map[string]int{}
+			}
+			counts[interval][p][name] += count
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	for _, interval := range chartIntervals {
+		res.rankPeriods(interval, counts[interval])
+	}
+	return res, nil
+}
+
+// rankPeriods adds the charts of every period of an interval,
+// in order, to the artists' chart stats
+func (res ChartHistory) rankPeriods(interval string, counts map[time.Time]map[string]int) {
+	periods := make([]time.Time, 0, len(counts))
+	for p := range counts {
+		periods = append(periods, p)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Before(periods[j])
+	})
+
+	// the length of each artist's latest run at #1
+	// and the last period in it
+	runLength := map[string]int{}
+	runEnd := map[string]time.Time{}
+
+	for _, p := range periods {
+		artists := counts[p]
+		names := make([]string, 0, len(artists))
+		for name := range artists {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return artists[names[i]] > artists[names[j]]
+		})
+
+		rank := 0
+		for i, name := range names {
+			if i == 0 || artists[name] < artists[names[i-1]] {
+				rank = i + 1
+			}
+
+			s := res.artists[name].stats(interval)
+			s.Charted++
+			if s.Peak == 0 || rank < s.Peak {
+				s.Peak = rank
+				s.PeakStart = p
+			}
+			if rank <= 10 {
+				s.TopTen++
+			}
+			if rank == 1 {
+				s.AtOne++
+				if end, ok := runEnd[name]; ok && nextPeriod(end, interval).Equal(p) {
+					runLength[name]++
+				} else {
+					runLength[name] = 1
+				}
+				runEnd[name] = p
+				if runLength[name] > s.LongestAtOne {
+					s.LongestAtOne = runLength[name]
+				}
+			}
+		}
+	}
+}
+
+// Artist returns the chart history of the artist with a name
+func (res ChartHistory) Artist(name string) (ArtistChartHistory, bool) {
+	artist, ok := res.artists[name]
+	if !ok {
+		return ArtistChartHistory{Name: name}, false
+	}
+	return *artist, true
+}
+
+// ChartRecord is an artist holding an all-time chart record, where
+// Count is whatever the record counts
+type ChartRecord struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"artist"`
+	Count int    `json:"count"`
+}
+
+// ChartRecords are the artists with the most periods at #1 and in the
+// top 10, and the longest runs at #1, of each kind of chart
+type ChartRecords struct {
+	WeeksAtOne       []ChartRecord `json:"weeksAtOne"`
+	WeeksInTopTen    []ChartRecord `json:"weeksInTopTen"`
+	LongestWeeksRun  []ChartRecord `json:"longestWeeksRun"`
+	MonthsAtOne      []ChartRecord `json:"monthsAtOne"`
+	MonthsInTopTen   []ChartRecord `json:"monthsInTopTen"`
+	LongestMonthsRun []ChartRecord `json:"longestMonthsRun"`
+	YearsAtOne       []ChartRecord `json:"yearsAtOne"`
+	YearsInTopTen    []ChartRecord `json:"yearsInTopTen"`
+}
+
+// Records finds the top limit artists for each all-time chart record
+func (res ChartHistory) Records(limit int) ChartRecords {
+	return ChartRecords{
+		WeeksAtOne:       res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Weekly.AtOne }),
+		WeeksInTopTen:    res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Weekly.TopTen }),
+		LongestWeeksRun:  res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Weekly.LongestAtOne }),
+		MonthsAtOne:      res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Monthly.AtOne }),
+		MonthsInTopTen:   res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Monthly.TopTen }),
+		LongestMonthsRun: res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Monthly.LongestAtOne }),
+		YearsAtOne:       res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Yearly.AtOne }),
+		YearsInTopTen:    res.recordHolders(limit, func(h *ArtistChartHistory) int { return h.Yearly.TopTen }),
+	}
+}
+
+// recordHolders ranks artists by a count, leaving out
+// anyone with a count of zero
+func (res ChartHistory) recordHolders(limit int, count func(*ArtistChartHistory) int) []ChartRecord {
+	records := []ChartRecord{}
+	for _, h := range res.artists {
+		if n := count(h); n > 0 {
+			records = append(records, ChartRecord{ID: h.ID, Name: h.Name, Count: n})
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Count != records[j].Count {
+			return records[i].Count > records[j].Count
+		}
+		return records[i].Name < records[j].Name
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
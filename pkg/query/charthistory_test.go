@@ -0,0 +1,57 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActivityVersion(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+	storePlays(t, db, []testPlay{
+		{uts: start, artist: "Low", title: "Words"},
+		{uts: start + 300, artist: "Broadcast", title: "Tears in the Typing Pool"},
+	})
+
+	current := func() ActivityVersion {
+		v, err := CurrentActivityVersion(db.SQL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	seen := map[ActivityVersion]string{}
+	changed := func(what string) {
+		v := current()
+		if before, ok := seen[v]; ok {
+			t.Errorf("version after %s is the same as after %s", what, before)
+		}
+		seen[v] = what
+	}
+
+	changed("storing plays")
+	if v := current(); seen[v] != "storing plays" {
+		t.Error("version changed without any changes")
+	}
+
+	low, err := db.AddExclusion("artist", "Low")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed("excluding one artist")
+
+	// swapping one exclusion for another leaves as many plays excluded
+	err = db.RemoveExclusion(low.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.AddExclusion("artist", "Broadcast"); err != nil {
+		t.Fatal(err)
+	}
+	changed("excluding a different artist")
+
+	storePlays(t, db, []testPlay{{uts: start + 600, artist: "Low", title: "Lazy"}})
+	changed("storing another play")
+}
@@ -0,0 +1,34 @@
+package query
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DailyCounts counts plays per calendar day in tz, for every day from
+// start up to end. Days are local days rather than the utc days that
+// grouping on dt would give, so each day's count matches that day's plays
+func DailyCounts(db *sql.DB, start, end time.Time, tz *time.Location) ([]PeriodCount, error) {
+	daily := []PeriodCount{}
+
+	counts := map[time.Time]int{}
+	err := forEachSlot(db, start, end, func(slot time.Time, count int) {
+		counts[dayStart(slot, tz)] += count
+	})
+	if err != nil {
+		return daily, err
+	}
+
+	for day := dayStart(start, tz); day.Before(end); day = day.AddDate(0, 0, 1) {
+		daily = append(daily, PeriodCount{Start: day, PlayCount: counts[day]})
+	}
+	return daily, nil
+}
+
+// DayPlays finds every play on the calendar day in tz
+// that contains day, oldest first
+func DayPlays(db *sql.DB, day time.Time, tz *time.Location) ([]ActivityResult, error) {
+	start := dayStart(day, tz)
+	end := start.AddDate(0, 0, 1)
+	return activityPlays(db, tz, "a.uts >= ? and a.uts < ?", start.Unix(), end.Unix())
+}
@@ -0,0 +1,61 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+// kolkataPlays is three plays in India, which is utc+5:30. The first two
+// are in the same utc hour but either side of local midnight, and the
+// third is on the next utc day but the local day after that
+func kolkataPlays() []testPlay {
+	return []testPlay{
+		{uts: time.Date(2024, time.March, 1, 18, 20, 0, 0, time.UTC).Unix(), artist: "Low", title: "Words"},
+		{uts: time.Date(2024, time.March, 1, 18, 40, 0, 0, time.UTC).Unix(), artist: "Low", title: "Lazy"},
+		{uts: time.Date(2024, time.March, 3, 18, 35, 0, 0, time.UTC).Unix(), artist: "Low", title: "Words"},
+	}
+}
+
+func TestDailyCountsHalfHourZone(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	storePlays(t, db, kolkataPlays())
+
+	kolkata := loadZone(t, "Asia/Kolkata")
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, kolkata)
+	daily, err := DailyCounts(db.SQL, start, start.AddDate(0, 0, 5), kolkata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{1, 1, 0, 1, 0}
+	if len(daily) != len(want) {
+		t.Fatalf("got %d days, want %d", len(daily), len(want))
+	}
+	for i, d := range daily {
+		if !d.Start.Equal(start.AddDate(0, 0, i)) || d.PlayCount != want[i] {
+			t.Errorf("day %d is %v with %d plays, want %v with %d", i,
+				d.Start, d.PlayCount, start.AddDate(0, 0, i), want[i])
+		}
+	}
+}
+
+func TestStreaksHalfHourZone(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	storePlays(t, db, kolkataPlays())
+
+	kolkata := loadZone(t, "Asia/Kolkata")
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, kolkata)
+	streaks, err := Streaks(db.SQL, kolkata, start.AddDate(0, 0, 10), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	longest := Streak{Start: start, End: start.AddDate(0, 0, 1), Days: 2}
+	if !streaks.Longest.Start.Equal(longest.Start) || !streaks.Longest.End.Equal(longest.End) ||
+		streaks.Longest.Days != longest.Days {
+		t.Errorf("longest streak is %+v, want %+v", streaks.Longest, longest)
+	}
+	if len(streaks.Artists) != 1 || streaks.Artists[0].Streak.Days != 2 {
+		t.Errorf("artist streaks are %+v", streaks.Artists)
+	}
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// DateRangeModes are the calendar periods a date range can page through.
+// "week" is the 7 days before today, "calweek" is a calendar week
+// starting on a chosen day and "isoweek" is an ISO 8601 week, which
+// always starts on Monday. "all" covers everything up to the end of
+// today and "custom" is any span of whole days, see CustomDateRange
+var DateRangeModes = []string{"day", "week", "calweek", "isoweek", "month", "quarter", "year", "all"}
+
+// customDateFormat is the format of custom range start/end dates
+const customDateFormat = "2006-01-02"
+
+// NewDateRange computes the date range for mode that is offset periods
+// before the current one, where the current one contains now. weekStart
+// is the first day of a calendar week. All of the period boundaries are
+// midnight in tz, so a day can be 23 or 25 hours long across a daylight
+// saving change
+func NewDateRange(mode string, offset int, now time.Time, tz *time.Location, weekStart time.Weekday) (DateRangeParams, error) {
+	params := DateRangeParams{
+		Mode:      mode,
+		Offset:    offset,
+		Limit:     20,
+		TZ:        tz,
+		WeekStart: weekStart,
+	}
+
+	now = now.In(tz)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, tz)
+
+	switch mode {
+	case "day":
+		params.Start = today.AddDate(0, 0, -offset)
+		params.End = params.Start.AddDate(0, 0, 1)
+	case "week":
+		// show week ending today / last 7 days
+		params.End = today.AddDate(0, 0, -offset*7)
+		params.Start = params.End.AddDate(0, 0, -7)
+	case "calweek", "isoweek":
+		// week to date, like month
+		if mode == "isoweek" {
+			params.WeekStart = time.Monday
+		}
+		daysIn := (int(today.Weekday()) - int(params.WeekStart) + 7) % 7
+		params.Start = today.AddDate(0, 0, -daysIn-offset*7)
+		params.End = params.Start.AddDate(0, 0, 7)
+	case "month":
+		// show month to date (inconsistent with week)
+		tmp := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, tz)
+		params.Start = tmp.AddDate(0, -offset, 0)
+		params.End = params.Start.AddDate(0, 1, 0)
+	case "quarter":
+		firstMonth := time.Month((int(now.Month())-1)/3*3 + 1)
+		tmp := time.Date(now.Year(), firstMonth, 1, 0, 0, 0, 0, tz)
+		params.Start = tmp.AddDate(0, -offset*3, 0)
+		params.End = params.Start.AddDate(0, 3, 0)
+	case "year":
+		params.Start = time.Date(now.Year()-offset, time.January, 1, 0, 0, 0, 0, tz)
+		params.End = params.Start.AddDate(1, 0, 0)
+	case "all":
+		// there's only one "all time", so offset is ignored
+		params.Offset = 0
+		params.Start = time.Unix(0, 0).In(tz)
+		params.End = today.AddDate(0, 0, 1)
+	default:
+		return params, errors.New("invalid value for parameter: mode")
+	}
+
+	return params, nil
+}
+
+// CustomDateRange covers whole days in tz from start to end inclusive,
+// both formatted as 2006-01-02
+func CustomDateRange(start, end string, tz *time.Location) (DateRangeParams, error) {
+	params := DateRangeParams{
+		Mode:  "custom",
+		Limit: 20,
+		TZ:    tz,
+	}
+
+	s, err := time.ParseInLocation(customDateFormat, start, tz)
+	if err != nil {
+		return params, errors.New("invalid format for parameter: start")
+	}
+	e, err := time.ParseInLocation(customDateFormat, end, tz)
+	if err != nil {
+		return params, errors.New("invalid format for parameter: end")
+	}
+	if e.Before(s) {
+		return params, errors.New("invalid parameters: end is before start")
+	}
+
+	params.Start = s
+	params.End = e.AddDate(0, 0, 1)
+	return params, nil
+}
+
+// Days returns the number of calendar days in the range
+func (dp DateRangeParams) Days() int {
+	// days aren't always 24 hours long, but they're
+	// never far enough off for rounding to go wrong
+	return int(math.Round(dp.End.Sub(dp.Start).Hours() / 24))
+}
+
+// LastDay returns the start of the final day in the range, which
+// is the inclusive end date for display
+func (dp DateRangeParams) LastDay() time.Time {
+	return dp.End.AddDate(0, 0, -1)
+}
+
+// Shift returns a range of the same mode and length n periods earlier,
+// or later if n is negative
+func (dp DateRangeParams) Shift(n int) DateRangeParams {
+	shifted := dp
+	shifted.Offset += n
+	shifted.Start = dp.PeriodsBefore(n)
+
+	switch dp.Mode {
+	case "day":
+		shifted.End = shifted.Start.AddDate(0, 0, 1)
+	case "week", "calweek", "isoweek":
+		shifted.End = shifted.Start.AddDate(0, 0, 7)
+	case "month":
+		shifted.End = shifted.Start.AddDate(0, 1, 0)
+	case "quarter":
+		shifted.End = shifted.Start.AddDate(0, 3, 0)
+	case "year":
+		shifted.End = shifted.Start.AddDate(1, 0, 0)
+	case "custom":
+		shifted.End = shifted.Start.AddDate(0, 0, dp.Days())
+	default:
+		shifted = dp
+	}
+	return shifted
+}
+
+// PeriodsBefore returns the start of the period n periods before the
+// start of this range. Custom ranges count in periods of their own
+// length, and "all" has nothing before it so its own start is returned
+func (dp DateRangeParams) PeriodsBefore(n int) time.Time {
+	switch dp.Mode {
+	case "day":
+		return dp.Start.AddDate(0, 0, -n)
+	case "week", "calweek", "isoweek":
+		return dp.Start.AddDate(0, 0, -7*n)
+	case "month":
+		return dp.Start.AddDate(0, -n, 0)
+	case "quarter":
+		return dp.Start.AddDate(0, -3*n, 0)
+	case "year":
+		return dp.Start.AddDate(-n, 0, 0)
+	case "custom":
+		return dp.Start.AddDate(0, 0, -n*dp.Days())
+	}
+	return dp.Start
+}
@@ -0,0 +1,226 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+// US daylight saving time in 2024 started on March 10 and ended on
+// November 3, so those days were 23 and 25 hours long in New York
+
+func nyDay(t *testing.T, year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, loadZone(t, "America/New_York"))
+}
+
+func TestNewDateRange(t *testing.T) {
+	ny := loadZone(t, "America/New_York")
+	// a Wednesday afternoon, after the spring change
+	now := time.Date(2024, time.March, 13, 15, 0, 0, 0, ny)
+
+	tests := []struct {
+		name      string
+		mode      string
+		offset    int
+		now       time.Time
+		weekStart time.Weekday
+		start     time.Time
+		end       time.Time
+		days      int
+	}{
+		{"today", "day", 0, now, time.Sunday,
+			nyDay(t, 2024, 3, 13), nyDay(t, 2024, 3, 14), 1},
+		{"spring forward day", "day", 3, now, time.Sunday,
+			nyDay(t, 2024, 3, 10), nyDay(t, 2024, 3, 11), 1},
+		{"fall back day", "day", 0, time.Date(2024, time.November, 3, 12, 0, 0, 0, ny), time.Sunday,
+			nyDay(t, 2024, 11, 3), nyDay(t, 2024, 11, 4), 1},
+		{"late evening is still local today", "day", 0, time.Date(2024, time.March, 11, 3, 30, 0, 0, time.UTC), time.Sunday,
+			nyDay(t, 2024, 3, 10), nyDay(t, 2024, 3, 11), 1},
+		{"last 7 days", "week", 0, now, time.Sunday,
+			nyDay(t, 2024, 3, 6), nyDay(t, 2024, 3, 13), 7},
+		{"7 days before that", "week", 1, now, time.Sunday,
+			nyDay(t, 2024, 2, 28), nyDay(t, 2024, 3, 6), 7},
+		{"calendar week from sunday", "calweek", 0, now, time.Sunday,
+			nyDay(t, 2024, 3, 10), nyDay(t, 2024, 3, 17), 7},
+		{"calendar week from saturday", "calweek", 1, now, time.Saturday,
+			nyDay(t, 2024, 3, 2), nyDay(t, 2024, 3, 9), 7},
+		{"iso week ignores week start", "isoweek", 0, now, time.Sunday,
+			nyDay(t, 2024, 3, 11), nyDay(t, 2024, 3, 18), 7},
+		{"iso week on a sunday", "isoweek", 0, nyDay(t, 2024, 3, 10).Add(12 * time.Hour), time.Sunday,
+			nyDay(t, 2024, 3, 4), nyDay(t, 2024, 3, 11), 7},
+		{"this month", "month", 0, now, time.Sunday,
+			nyDay(t, 2024, 3, 1), nyDay(t, 2024, 4, 1), 31},
+		{"leap february", "month", 1, now, time.Sunday,
+			nyDay(t, 2024, 2, 1), nyDay(t, 2024, 3, 1), 29},
+		{"month across new year", "month", 3, now, time.Sunday,
+			nyDay(t, 2023, 12, 1), nyDay(t, 2024, 1, 1), 31},
+		{"this quarter", "quarter", 0, now, time.Sunday,
+			nyDay(t, 2024, 1, 1), nyDay(t, 2024, 4, 1), 91},
+		{"previous quarter", "quarter", 1, now, time.Sunday,
+			nyDay(t, 2023, 10, 1), nyDay(t, 2024, 1, 1), 92},
+		{"quarter with fall back", "quarter", 0, time.Date(2024, time.November, 3, 12, 0, 0, 0, ny), time.Sunday,
+			nyDay(t, 2024, 10, 1), nyDay(t, 2025, 1, 1), 92},
+		{"last year", "year", 1, now, time.Sunday,
+			nyDay(t, 2023, 1, 1), nyDay(t, 2024, 1, 1), 365},
+		{"all time", "all", 0, now, time.Sunday,
+			time.Unix(0, 0), nyDay(t, 2024, 3, 14), 19796},
+	}
+
+	for _, tt := range tests {
+		params, err := NewDateRange(tt.mode, tt.offset, tt.now, ny, tt.weekStart)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !params.Start.Equal(tt.start) || !params.End.Equal(tt.end) {
+			t.Errorf("%s: got %v to %v, want %v to %v", tt.name,
+				params.Start, params.End, tt.start, tt.end)
+		}
+		if params.Days() != tt.days {
+			t.Errorf("%s: got %d days, want %d", tt.name, params.Days(), tt.days)
+		}
+		if params.Mode != tt.mode || params.TZ != ny {
+			t.Errorf("%s: got mode %s in %v", tt.name, params.Mode, params.TZ)
+		}
+	}
+
+	// the spring and fall days aren't 24 hours long
+	spring, _ := NewDateRange("day", 3, now, ny, time.Sunday)
+	if d := spring.End.Sub(spring.Start); d != 23*time.Hour {
+		t.Errorf("spring forward day is %v long", d)
+	}
+	fall, _ := NewDateRange("day", 0, time.Date(2024, time.November, 3, 12, 0, 0, 0, ny), ny, time.Sunday)
+	if d := fall.End.Sub(fall.Start); d != 25*time.Hour {
+		t.Errorf("fall back day is %v long", d)
+	}
+
+	all, _ := NewDateRange("all", 4, now, ny, time.Sunday)
+	if all.Offset != 0 {
+		t.Errorf("all time has offset %d, want 0", all.Offset)
+	}
+	if _, err := NewDateRange("fortnight", 0, now, ny, time.Sunday); err == nil {
+		t.Error("no error for an unknown mode")
+	}
+}
+
+func TestCustomDateRange(t *testing.T) {
+	ny := loadZone(t, "America/New_York")
+
+	tests := []struct {
+		start, end string
+		wantStart  time.Time
+		wantEnd    time.Time
+		days       int
+	}{
+		{"2024-03-09", "2024-03-11", nyDay(t, 2024, 3, 9), nyDay(t, 2024, 3, 12), 3},
+		{"2024-03-10", "2024-03-10", nyDay(t, 2024, 3, 10), nyDay(t, 2024, 3, 11), 1},
+		{"2024-11-01", "2024-11-30", nyDay(t, 2024, 11, 1), nyDay(t, 2024, 12, 1), 30},
+	}
+	for _, tt := range tests {
+		params, err := CustomDateRange(tt.start, tt.end, ny)
+		if err != nil {
+			t.Errorf("%s to %s: %v", tt.start, tt.end, err)
+			continue
+		}
+		if !params.Start.Equal(tt.wantStart) || !params.End.Equal(tt.wantEnd) {
+			t.Errorf("%s to %s: got %v to %v", tt.start, tt.end, params.Start, params.End)
+		}
+		if params.Days() != tt.days {
+			t.Errorf("%s to %s: got %d days, want %d", tt.start, tt.end, params.Days(), tt.days)
+		}
+		if !params.LastDay().Equal(nyDay(t, params.End.Year(), params.End.Month(), params.End.Day()-1)) {
+			t.Errorf("%s to %s: last day is %v", tt.start, tt.end, params.LastDay())
+		}
+	}
+
+	bad := [][2]string{
+		{"2024-03-11", "2024-03-09"}, // backwards
+		{"2024-3-9", "2024-03-11"},
+		{"2024-03-09", "tomorrow"},
+	}
+	for _, b := range bad {
+		if _, err := CustomDateRange(b[0], b[1], ny); err == nil {
+			t.Errorf("%s to %s: no error", b[0], b[1])
+		}
+	}
+}
+
+func TestShiftAndPeriodsBefore(t *testing.T) {
+	ny := loadZone(t, "America/New_York")
+	now := time.Date(2024, time.March, 13, 15, 0, 0, 0, ny)
+
+	rangeFor := func(mode string, offset int) DateRangeParams {
+		params, err := NewDateRange(mode, offset, now, ny, time.Sunday)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return params
+	}
+	custom, err := CustomDateRange("2024-03-09", "2024-03-11", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params DateRangeParams
+		n      int
+		start  time.Time
+		end    time.Time
+	}{
+		{"day into spring forward", rangeFor("day", 2), 1,
+			nyDay(t, 2024, 3, 10), nyDay(t, 2024, 3, 11)},
+		{"day out of spring forward", rangeFor("day", 3), -1,
+			nyDay(t, 2024, 3, 11), nyDay(t, 2024, 3, 12)},
+		{"week", rangeFor("week", 0), 2,
+			nyDay(t, 2024, 2, 21), nyDay(t, 2024, 2, 28)},
+		{"calendar week", rangeFor("calweek", 0), 1,
+			nyDay(t, 2024, 3, 3), nyDay(t, 2024, 3, 10)},
+		{"iso week", rangeFor("isoweek", 0), -1,
+			nyDay(t, 2024, 3, 18), nyDay(t, 2024, 3, 25)},
+		{"month", rangeFor("month", 0), 2,
+			nyDay(t, 2024, 1, 1), nyDay(t, 2024, 2, 1)},
+		{"quarter", rangeFor("quarter", 0), 1,
+			nyDay(t, 2023, 10, 1), nyDay(t, 2024, 1, 1)},
+		{"two quarters back", rangeFor("quarter", 0), 2,
+			nyDay(t, 2023, 7, 1), nyDay(t, 2023, 10, 1)},
+		{"year", rangeFor("year", 0), 1,
+			nyDay(t, 2023, 1, 1), nyDay(t, 2024, 1, 1)},
+		{"custom range of its own length", custom, 1,
+			nyDay(t, 2024, 3, 6), nyDay(t, 2024, 3, 9)},
+		{"custom range later", custom, -2,
+			nyDay(t, 2024, 3, 15), nyDay(t, 2024, 3, 18)},
+		{"all time doesn't move", rangeFor("all", 0), 1,
+			time.Unix(0, 0), nyDay(t, 2024, 3, 14)},
+	}
+
+	for _, tt := range tests {
+		if before := tt.params.PeriodsBefore(tt.n); !before.Equal(tt.start) {
+			t.Errorf("%s: %d periods before is %v, want %v", tt.name, tt.n, before, tt.start)
+		}
+
+		shifted := tt.params.Shift(tt.n)
+		if !shifted.Start.Equal(tt.start) || !shifted.End.Equal(tt.end) {
+			t.Errorf("%s: shifted by %d is %v to %v, want %v to %v", tt.name, tt.n,
+				shifted.Start, shifted.End, tt.start, tt.end)
+		}
+		wantOffset := tt.params.Offset + tt.n
+		if tt.params.Mode == "all" {
+			wantOffset = 0 // like NewDateRange
+		}
+		if shifted.Mode != tt.params.Mode || shifted.Offset != wantOffset {
+			t.Errorf("%s: shifted to %s offset %d", tt.name, shifted.Mode, shifted.Offset)
+		}
+	}
+
+	// a shifted range is the same as asking for that offset
+	for _, mode := range []string{"day", "week", "calweek", "isoweek", "month", "quarter", "year"} {
+		for offset := 0; offset < 40; offset++ {
+			want := rangeFor(mode, offset)
+			got := rangeFor(mode, 0).Shift(offset)
+			if !got.Start.Equal(want.Start) || !got.End.Equal(want.End) || got.Offset != want.Offset {
+				t.Errorf("%s shifted by %d is %v to %v, want %v to %v", mode, offset,
+					got.Start, got.End, want.Start, want.End)
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package query
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// helpers shared by the artist, album and track detail queries.
+// sqlite can't convert between timezones, so plays are fetched as unix
+// times (or counted per quarter hour, see slotExpr) and bucketed into
+// calendar periods in Go
+
+// playCount is a number of plays at some time, either a single
+// play or everything in a quarter hour
+type playCount struct {
+	when  time.Time
+	count int
+}
+
+// slotPlays counts the plays matching a filter on activity (aliased
+// as "a") per quarter hour
+func slotPlays(db *sql.DB, filter string, args ...interface{}) ([]playCount, error) {
+	var plays []playCount
+
+	query := `select ` + slotExpr + `, count(*)
+	from activity a
+	where ` + filter + `
+	and not ` + isExcluded + `
+	group by 1
+	order by 1;`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return plays, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slot int64
+		var count int
+		err = rows.Scan(&slot, &count)
+		if err != nil {
+			return plays, err
+		}
+		plays = append(plays, playCount{when: slotTime(slot), count: count})
+	}
+	return plays, rows.Err()
+}
+
+// activityPlays finds every play matching a filter on activity
+// (aliased as "a"), oldest first
+func activityPlays(db *sql.DB, tz *time.Location, filter string, args ...interface{}) ([]ActivityResult, error) {
+	plays := []ActivityResult{}
+
+	query := `select a.id, a.artist_id, a.album_id, a.uts, a.artist, a.title, a.album, i.url
+	from activity a
+	left join image i on a.image_id = i.id
+	where ` + filter + `
+	and not ` + isExcluded + `
+	order by a.uts, a.id;`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return plays, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uts int64
+		var imageURL sql.NullString
+		res := ActivityResult{}
+		err = rows.Scan(&res.ID, &res.ArtistID, &res.AlbumID, &uts,
+			&res.Artist, &res.Title, &res.Album, &imageURL)
+		if err != nil {
+			return plays, err
+		}
+		res.Time = time.Unix(uts, 0).In(tz)
+		if imageURL.Valid {
+			res.ImageURLs = []string{imageURL.String}
+		} else {
+			res.ImageURLs = []string{}
+		}
+		plays = append(plays, res)
+	}
+	return plays, rows.Err()
+}
+
+// singlePlays converts a list of plays for the period helpers
+func singlePlays(activity []ActivityResult) []playCount {
+	plays := make([]playCount, len(activity))
+	for i, a := range activity {
+		plays[i] = playCount{when: a.Time, count: 1}
+	}
+	return plays
+}
+
+// monthlyCounts sums plays (in time order) per calendar month in tz,
+// including empty months between the first and last play
+func monthlyCounts(plays []playCount, tz *time.Location) []PeriodCount {
+	monthly := []PeriodCount{}
+	if len(plays) == 0 {
+		return monthly
+	}
+
+	counts := map[time.Time]int{}
+	for _, p := range plays {
+		t := p.when.In(tz)
+		counts[time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, tz)] += p.count
+	}
+
+	t := plays[0].when.In(tz)
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, tz)
+	t = plays[len(plays)-1].when.In(tz)
+	last := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, tz)
+
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		monthly = append(monthly, PeriodCount{Start: month, PlayCount: counts[month]})
+	}
+	return monthly
+}
+
+// busiestDays finds the calendar days in tz with the most plays
+func busiestDays(plays []playCount, tz *time.Location, limit int) []PeriodCount {
+	days := []PeriodCount{}
+
+	counts := map[time.Time]int{}
+	for _, p := range plays {
+		t := p.when.In(tz)
+		counts[time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, tz)] += p.count
+	}
+	for day, count := range counts {
+		days = append(days, PeriodCount{Start: day, PlayCount: count})
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].PlayCount != days[j].PlayCount {
+			return days[i].PlayCount > days[j].PlayCount
+		}
+		return days[i].Start.Before(days[j].Start)
+	})
+	if len(days) > limit {
+		days = days[:limit]
+	}
+	return days
+}
+
+// clockCounts sums plays by hour of the day in tz
+func clockCounts(plays []playCount, tz *time.Location) []int {
+	clock := make([]int, 24)
+	for _, p := range plays {
+		clock[p.when.In(tz).Hour()] += p.count
+	}
+	return clock
+}
+
+// TrackDetail is the complete listening history of a single track. Tracks
+// don't have a table of their own, so a track's id is the activity id of
+// its first play
+type TrackDetail struct {
+	ID           int64            `json:"id"`
+	ArtistID     int64            `json:"artistId"`
+	Artist       string           `json:"artist"`
+	Title        string           `json:"title"`
+	ImageURL     string           `json:"url"`
+	TotalPlays   int              `json:"count"`
+	Plays        []ActivityResult `json:"plays"`
+	Monthly      []PeriodCount    `json:"monthly"`
+	Clock        []int            `json:"clock"` // plays per hour of the day
+	FirstSession Session          `json:"firstSession"`
+}
+
+// TrackHistory collects every play of the track with the given id, with
+// months and hours in tz and sessions split by gap. sql.ErrNoRows is
+// returned if there is no such track. Any play of a track can be used as
+// its id, but the result always has the id of the first play
+func TrackHistory(db *sql.DB, id int64, tz *time.Location, gap time.Duration) (TrackDetail, error) {
+	res := TrackDetail{
+		ID:      id,
+		Plays:   []ActivityResult{},
+		Monthly: []PeriodCount{},
+		Clock:   make([]int, 24),
+	}
+
+	err := db.QueryRow(`select artist, title from activity where id = ?`, id).Scan(&res.Artist, &res.Title)
+	if err != nil {
+		return res, err
+	}
+
+	res.Plays, err = activityPlays(db, tz, "a.artist = ? and a.title = ?", res.Artist, res.Title)
+	if err != nil || len(res.Plays) == 0 {
+		return res, err
+	}
+
+	first := res.Plays[0]
+	res.ID = first.ID
+	res.ArtistID = first.ArtistID
+	res.TotalPlays = len(res.Plays)
+	if len(first.ImageURLs) > 0 {
+		res.ImageURL = first.ImageURLs[0]
+	}
+
+	plays := singlePlays(res.Plays)
+	res.Monthly = monthlyCounts(plays, tz)
+	res.Clock = clockCounts(plays, tz)
+
+	res.FirstSession, err = sessionAround(db, first, tz, gap)
+	return res, err
+}
+
+// AlbumDetail is the complete listening history of a single album
+type AlbumDetail struct {
+	ID           int64            `json:"id"`
+	ArtistID     int64            `json:"artistId"`
+	Artist       string           `json:"artist"`
+	Album        string           `json:"album"`
+	ImageURL     string           `json:"url"`
+	TotalPlays   int              `json:"count"`
+	Tracks       []TrackResult    `json:"tracks"`
+	Plays        []ActivityResult `json:"plays"`
+	Monthly      []PeriodCount    `json:"monthly"`
+	Clock        []int            `json:"clock"` // plays per hour of the day
+	FirstSession Session          `json:"firstSession"`
+}
+
+// AlbumHistory collects every play of an album, with months and hours in
+// tz and sessions split by gap. Like TopAlbums, an album is an album name
+// played by a single artist, and id is the activity id of any of its plays
+// (the album table is keyed by name alone, so its ids are shared between
+// artists). sql.ErrNoRows is returned if there is no such album
+func AlbumHistory(db *sql.DB, id int64, tz *time.Location, gap time.Duration) (AlbumDetail, error) {
+	res := AlbumDetail{
+		ID:      id,
+		Tracks:  []TrackResult{},
+		Plays:   []ActivityResult{},
+		Monthly: []PeriodCount{},
+		Clock:   make([]int, 24),
+	}
+
+	err := db.QueryRow(`select artist, album from activity where id = ?`, id).Scan(&res.Artist, &res.Album)
+	if err != nil {
+		return res, err
+	}
+	if res.Album == "" {
+		return res, sql.ErrNoRows
+	}
+
+	res.Plays, err = activityPlays(db, tz, "a.artist = ? and a.album = ?", res.Artist, res.Album)
+	if err != nil || len(res.Plays) == 0 {
+		return res, err
+	}
+
+	first := res.Plays[0]
+	res.ArtistID = first.ArtistID
+	res.TotalPlays = len(res.Plays)
+	if len(first.ImageURLs) > 0 {
+		res.ImageURL = first.ImageURLs[0]
+	}
+
+	plays := singlePlays(res.Plays)
+	res.Monthly = monthlyCounts(plays, tz)
+	res.Clock = clockCounts(plays, tz)
+
+	query := `select min(a.id), min(a.artist_id), a.artist, a.title, count(*) as plays, group_concat(distinct i.url)
+	from activity a
+	left join image i on a.image_id = i.id
+	where a.artist = ? and a.album = ?
+	and not ` + isExcluded + `
+	group by a.artist, a.title
+	order by plays desc, a.title;`
+
+	res.Tracks, err = scanTopTracks(db.Query(query, res.Artist, res.Album))
+	if err != nil {
+		return res, err
+	}
+
+	res.FirstSession, err = sessionAround(db, first, tz, gap)
+	return res, err
+}
@@ -0,0 +1,44 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlbumHistorySharedName(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// the album table is keyed by name, so both of these
+	// albums get the same album_id
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+	storePlays(t, db, []testPlay{
+		{uts: start, artist: "Low", album: "Greatest Hits", title: "Words"},
+		{uts: start + 300, artist: "Low", album: "Greatest Hits", title: "Lazy"},
+		{uts: start + 600, artist: "Broadcast", album: "Greatest Hits", title: "Echo's Answer"},
+	})
+
+	params, err := CustomDateRange("2024-03-01", "2024-03-01", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.Limit = 10
+	albums, err := TopAlbums(db.SQL, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 2 {
+		t.Fatalf("got %d albums, want 2", len(albums))
+	}
+
+	for _, album := range albums {
+		detail, err := AlbumHistory(db.SQL, album.ID, time.UTC, DefaultSessionGap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detail.Artist != album.Artist || detail.TotalPlays != album.PlayCount {
+			t.Errorf("album %d is %s with %d plays, want %s with %d", album.ID,
+				detail.Artist, detail.TotalPlays, album.Artist, album.PlayCount)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package query
+
+import (
+	"database/sql"
+	"time"
+)
+
+// discoveries are artists, albums and tracks that were played for the
+// first time ever during a period
+
+// DiscoveryParams are the fewest plays in a period that make something
+// new count as a discovery rather than a passing listen
+type DiscoveryParams struct {
+	MinArtistPlays int
+	MinAlbumPlays  int
+	MinTrackPlays  int
+	Limit          int
+}
+
+// DefaultDiscoveryParams are the thresholds used when none are given
+func DefaultDiscoveryParams() DiscoveryParams {
+	return DiscoveryParams{
+		MinArtistPlays: 4,
+		MinAlbumPlays:  4,
+		MinTrackPlays:  2,
+		Limit:          20,
+	}
+}
+
+// Discovery is an artist, album or track first played during a period.
+// Artists have neither an Album nor a Title, albums have no Title and
+// tracks have no Album. ID is whatever id the detail page for that kind
+// of thing takes
+type Discovery struct {
+	ID          int64     `json:"id"`
+	ArtistID    int64     `json:"artistId"`
+	Artist      string    `json:"artist"`
+	Album       string    `json:"album,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	PlayCount   int       `json:"count"` // plays during the period
+	FirstPlayed time.Time `json:"firstPlayed"`
+	ImageURL    string    `json:"url"`
+}
+
+// Discoveries is everything discovered during a period, along with how
+// much of the period's listening went to new music. The shares count all
+// plays of new artists and tracks, whether or not they passed the
+// thresholds
+type Discoveries struct {
+	Artists        []Discovery `json:"artists"`
+	Albums         []Discovery `json:"albums"`
+	Tracks         []Discovery `json:"tracks"`
+	TotalPlays     int         `json:"count"`
+	NewArtistPlays int         `json:"newArtistCount"`
+	NewTrackPlays  int         `json:"newTrackCount"`
+	NewArtistShare float64     `json:"newArtistShare"`
+	NewTrackShare  float64     `json:"newTrackShare"`
+}
+
+// discover finds everything first played during a date range, grouping
+// activity (aliased as "a") by group and picking id, album and title
+// columns for the Discovery. filter limits which activity is considered.
+// The total plays of everything found is returned along with the
+// discoveries that have at least minPlays plays
+func discover(db *sql.DB, params DateRangeParams, id, album, title, group, filter string, minPlays, limit int) ([]Discovery, int, error) {
+	found := []Discovery{}
+
+	query := `select d.id, d.artist_id, d.artist, d.album, d.title, d.plays, d.first, i.url from
+	(select min(` + id + `) as id, min(a.artist_id) as artist_id, a.artist,
+	` + album + ` as album, ` + title + ` as title,
+	sum(a.uts < ?) as plays, min(a.uts) as first, min(a.image_id) as img_id
+	from activity a
+	where ` + filter + `
+	and not ` + isExcluded + `
+	group by ` + group + `
+	having min(a.uts) >= ?
+	and min(a.uts) < ?) d
+	left join image i on i.id = d.img_id
+	order by d.plays desc, d.artist, d.album, d.title;`
+
+	end := params.End.Unix()
+	rows, err := db.Query(query, end, params.Start.Unix(), end)
+	if err != nil {
+		return found, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		var d Discovery
+		var first int64
+		var imageURL sql.NullString
+		err = rows.Scan(&d.ID, &d.ArtistID, &d.Artist, &d.Album, &d.Title, &d.PlayCount, &first, &imageURL)
+		if err != nil {
+			return found, total, err
+		}
+
+		total += d.PlayCount
+		if d.PlayCount < minPlays || len(found) >= limit {
+			continue
+		}
+		d.FirstPlayed = time.Unix(first, 0).In(params.TZ)
+		if imageURL.Valid {
+			d.ImageURL = imageURL.String
+		}
+		found = append(found, d)
+	}
+	return found, total, rows.Err()
+}
+
+// Discover finds the artists, albums and tracks first played during a
+// date range
+func Discover(db *sql.DB, params DateRangeParams, dp DiscoveryParams) (Discoveries, error) {
+	var res Discoveries
+	var err error
+
+	res.Artists, res.NewArtistPlays, err = discover(db, params,
+		"a.artist_id", "''", "''", "a.artist", "1", dp.MinArtistPlays, dp.Limit)
+	if err != nil {
+		return res, err
+	}
+	res.Albums, _, err = discover(db, params,
+		"a.id", "a.album", "''", "a.artist, a.album", "a.album != ''", dp.MinAlbumPlays, dp.Limit)
+	if err != nil {
+		return res, err
+	}
+	res.Tracks, res.NewTrackPlays, err = discover(db, params,
+		"a.id", "''", "a.title", "a.artist, a.title", "1", dp.MinTrackPlays, dp.Limit)
+	if err != nil {
+		return res, err
+	}
+
+	query := `select count(*) from activity a
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `;`
+
+	err = db.QueryRow(query, params.Start.Unix(), params.End.Unix()).Scan(&res.TotalPlays)
+	if err != nil {
+		return res, err
+	}
+	if res.TotalPlays > 0 {
+		res.NewArtistShare = float64(res.NewArtistPlays) / float64(res.TotalPlays)
+		res.NewTrackShare = float64(res.NewTrackPlays) / float64(res.TotalPlays)
+	}
+	return res, nil
+}
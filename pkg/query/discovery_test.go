@@ -0,0 +1,68 @@
+package query
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewArtistsMatchDiscover(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Low is new in march with 2 plays then and 3 more in april,
+	// Broadcast with 4 in march and Stereolab was first played before
+	march := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	april := march.AddDate(0, 1, 0)
+	var plays []testPlay
+	add := func(start time.Time, artist string, n int) {
+		for i := 0; i < n; i++ {
+			plays = append(plays, testPlay{
+				uts:    start.Add(time.Duration(i) * 5 * time.Minute).Unix(),
+				artist: artist,
+				title:  fmt.Sprintf("Track %d", i),
+			})
+		}
+	}
+	add(march.AddDate(0, -2, 0), "Stereolab", 1)
+	add(march, "Low", 2)
+	add(march.Add(time.Hour), "Broadcast", 4)
+	add(march.Add(2*time.Hour), "Stereolab", 5)
+	add(april, "Low", 3)
+	storePlays(t, db, plays)
+
+	params, err := NewDateRange("month", 1, april, time.UTC, time.Sunday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, min := range []int{1, 2, 3, 4, 5} {
+		dp := DefaultDiscoveryParams()
+		dp.MinArtistPlays = min
+		discoveries, err := Discover(db.SQL, params, dp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var discovered []string
+		for _, d := range discoveries.Artists {
+			discovered = append(discovered, fmt.Sprintf("%s %d", d.Artist, d.PlayCount))
+		}
+
+		var newArtists []string
+		for _, fn := range []func(*sql.DB, DateRangeParams, int) ([]ArtistResult, error){
+			NewArtists, topNewArtistsActivity,
+		} {
+			artists, err := fn(db.SQL, params, min)
+			if err != nil {
+				t.Fatal(err)
+			}
+			newArtists = nil
+			for _, a := range artists {
+				newArtists = append(newArtists, fmt.Sprintf("%s %d", a.Name, a.PlayCount))
+			}
+			if fmt.Sprint(newArtists) != fmt.Sprint(discovered) {
+				t.Errorf("at least %d plays: new artists are %v, discoveries are %v", min, newArtists, discovered)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package query
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// diversity describes how spread out listening is over artists and
+// tracks. Entropy goes up and the top 10 share and gini coefficient go
+// down as listening gets broader
+
+// DiversityResult measures the diversity of listening in a period.
+// Entropy is the Shannon entropy of plays per artist in bits, and Gini
+// is the gini coefficient of plays per artist that were played at all
+type DiversityResult struct {
+	Start         time.Time `json:"start"`
+	PlayCount     int       `json:"count"`
+	UniqueArtists int       `json:"uniqueArtists"`
+	UniqueTracks  int       `json:"uniqueTracks"`
+	Entropy       float64   `json:"entropy"`
+	Top10Share    float64   `json:"top10Share"` // of plays going to the top 10 artists
+	Gini          float64   `json:"gini"`
+}
+
+// trackKey identifies a track by artist and title
+type trackKey struct {
+	artist, title string
+}
+
+// diversityOf calculates diversity from play counts per track
+func diversityOf(tracks map[trackKey]int) DiversityResult {
+	var res DiversityResult
+
+	artists := map[string]int{}
+	for t, count := range tracks {
+		artists[t.artist] += count
+		res.PlayCount += count
+	}
+	res.UniqueArtists = len(artists)
+	res.UniqueTracks = len(tracks)
+	if res.PlayCount == 0 {
+		return res
+	}
+
+	counts := make([]int, 0, len(artists))
+	for _, count := range artists {
+		counts = append(counts, count)
+	}
+	sort.Ints(counts)
+
+	total := float64(res.PlayCount)
+	weighted := 0.0
+	top10 := 0
+	for i, count := range counts {
+		p := float64(count) / total
+		res.Entropy -= p * math.Log2(p)
+		weighted += float64(i+1) * float64(count)
+		if i >= len(counts)-10 {
+			top10 += count
+		}
+	}
+	res.Top10Share = float64(top10) / total
+
+	n := float64(len(counts))
+	res.Gini = 2*weighted/(n*total) - (n+1)/n
+	return res
+}
+
+// firstPlay finds the start of the quarter hour of the earliest play,
+// which is in the same local day in every timezone. It's read from the
+// rollup, which leaves out excluded plays, so it doesn't have to check
+// every play against the exclusion list. ok is false if nothing has
+// been played
+func firstPlay(db *sql.DB) (t time.Time, ok bool, err error) {
+	var first sql.NullInt64
+	err = db.QueryRow(`select min(slot) from rollup_quarter_hour`).Scan(&first)
+	if err != nil || !first.Valid {
+		return t, false, err
+	}
+	return slotTime(first.Int64), true, nil
+}
+
+// Diversity measures the diversity of listening over a date range
+func Diversity(db *sql.DB, params DateRangeParams) (DiversityResult, error) {
+	query := `select a.artist, a.title, count(*)
+	from activity a
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `
+	group by a.artist, a.title;`
+
+	rows, err := db.Query(query, params.Start.Unix(), params.End.Unix())
+	if err != nil {
+		return DiversityResult{Start: params.Start}, err
+	}
+	defer rows.Close()
+
+	tracks := map[trackKey]int{}
+	for rows.Next() {
+		var t trackKey
+		var count int
+		err = rows.Scan(&t.artist, &t.title, &count)
+		if err != nil {
+			return DiversityResult{Start: params.Start}, err
+		}
+		tracks[t] = count
+	}
+
+	res := diversityOf(tracks)
+	res.Start = params.Start
+	return res, rows.Err()
+}
+
+// MonthlyDiversity measures diversity for each calendar month in tz
+// between start and end, skipping months before the first play
+func MonthlyDiversity(db *sql.DB, start, end time.Time, tz *time.Location) ([]DiversityResult, error) {
+	series := []DiversityResult{}
+
+	first, ok, err := firstPlay(db)
+	if err != nil || !ok {
+		return series, err
+	}
+	if first.After(start) {
+		start = first
+	}
+	start = start.In(tz)
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, tz)
+
+	query := `select a.artist, a.title, ` + slotExpr + `, count(*)
+	from activity a
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `
+	group by a.artist, a.title, ` + slotExpr + `;`
+
+	rows, err := db.Query(query, start.Unix(), end.Unix())
+	if err != nil {
+		return series, err
+	}
+	defer rows.Close()
+
+	months := map[time.Time]map[trackKey]int{}
+	for rows.Next() {
+		var t trackKey
+		var slot int64
+		var count int
+		err = rows.Scan(&t.artist, &t.title, &slot, &count)
+		if err != nil {
+			return series, err
+		}
+		when := slotTime(slot).In(tz)
+		month := time.Date(when.Year(), when.Month(), 1, 0, 0, 0, 0, tz)
+		if months[month] == nil {
+			months[month] = map[trackKey]int{}
+		}
+		months[month][t] += count
+	}
+	if err = rows.Err(); err != nil {
+		return series, err
+	}
+
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		res := diversityOf(months[month])
+		res.Start = month
+		series = append(series, res)
+	}
+	return series, nil
+}
@@ -0,0 +1,131 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExclusions(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	var plays []testPlay
+	add := func(hour int, artist, title string, n int) {
+		for i := 0; i < n; i++ {
+			plays = append(plays, testPlay{
+				uts:    day.Add(time.Duration(hour)*time.Hour + time.Duration(i)*5*time.Minute).Unix(),
+				artist: artist,
+				title:  title,
+			})
+		}
+	}
+	add(2, "Low", "Words", 3)
+	add(12, "Rain Sounds", "Thunderstorm", 5)
+	add(14, "Broadcast", "Echo's Answer", 2)
+	add(15, "Broadcast", "A Podcast Episode", 4)
+	storePlays(t, db, plays)
+
+	// the whole day is counted from the rollups,
+	// the afternoon from activity
+	wholeDay := DateRangeParams{Start: day, End: day.AddDate(0, 0, 1), Limit: 10, TZ: time.UTC}
+	afternoon := DateRangeParams{Start: day.Add(11 * time.Hour), End: day.Add(20 * time.Hour), Limit: 10, TZ: time.UTC}
+
+	charts := func() string {
+		var s string
+		for _, params := range []DateRangeParams{wholeDay, afternoon} {
+			artists, err := TopArtists(db.SQL, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tracks, err := TopTracks(db.SQL, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, a := range artists {
+				s += fmt.Sprintf("%s %d, ", a.Name, a.PlayCount)
+			}
+			s += "/ "
+			for _, tr := range tracks {
+				s += fmt.Sprintf("%s %d, ", tr.Title, tr.PlayCount)
+			}
+			s += "| "
+		}
+		return s
+	}
+	verify := func(when string) {
+		problems, err := VerifyRollups(db.SQL, day, day.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range problems {
+			t.Errorf("%s: %s", when, p)
+		}
+	}
+	version := func() ActivityVersion {
+		v, err := CurrentActivityVersion(db.SQL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	before := charts()
+	v := version()
+
+	// artist names match ignoring case, titles with like
+	rain, err := db.AddExclusion("artist", "rain sounds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.AddExclusion("title", "%podcast%"); err != nil {
+		t.Fatal(err)
+	}
+	want := "Low 3, Broadcast 2, / Words 3, Echo's Answer 2, | Broadcast 2, / Echo's Answer 2, | "
+	if got := charts(); got != want {
+		t.Errorf("after excluding charts are\n%s\nwant\n%s", got, want)
+	}
+	verify("after excluding")
+	if version().Exclusions != v.Exclusions+2 {
+		t.Errorf("exclusion version went from %d to %d", v.Exclusions, version().Exclusions)
+	}
+
+	milestones, err := FindMilestones(db.SQL, day, time.UTC, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if milestones.TotalPlays != 5 {
+		t.Errorf("milestones count %d plays, want 5", milestones.TotalPlays)
+	}
+
+	// adding the same one again gives back the same entry
+	again, err := db.AddExclusion("artist", "rain sounds")
+	if err != nil || again.ID != rain.ID {
+		t.Errorf("adding an exclusion again gave %+v, %v", again, err)
+	}
+
+	exclusions, err := db.ListExclusions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ex := range exclusions {
+		if err = db.RemoveExclusion(ex.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := charts(); got != before {
+		t.Errorf("after removing exclusions charts are\n%s\nwant\n%s", got, before)
+	}
+	verify("after removing exclusions")
+
+	if _, err = db.AddExclusion("genre", "ambient"); err == nil {
+		t.Error("no error for an invalid kind")
+	}
+	if _, err = db.AddExclusion("artist", "  "); err == nil {
+		t.Error("no error for an empty pattern")
+	}
+	if err = db.RemoveExclusion(rain.ID); err == nil {
+		t.Error("no error removing an exclusion that's gone")
+	}
+}
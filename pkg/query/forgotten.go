@@ -0,0 +1,166 @@
+package query
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// forgotten favorites are the opposite of new artists: music that was
+// played heavily at some point but hardly at all lately
+
+// ForgottenParams controls what counts as a forgotten favorite
+type ForgottenParams struct {
+	Now       time.Time
+	Months    int // length of the recent window before Now
+	MaxRecent int // most plays in the recent window that are still "forgotten"
+	MinPeak   int // fewest plays in the busiest month that were "heavy"
+	Limit     int
+	TZ        *time.Location
+}
+
+// NewForgottenParams returns the default parameters, looking back
+// six months from now
+func NewForgottenParams(now time.Time, tz *time.Location) ForgottenParams {
+	return ForgottenParams{
+		Now:       now,
+		Months:    6,
+		MaxRecent: 2,
+		MinPeak:   10,
+		Limit:     10,
+		TZ:        tz,
+	}
+}
+
+// ForgottenResult is an artist or track that used to be played a lot.
+// Tracks have a Title, and like elsewhere their ID is the activity id of
+// their first play. Artists have no title and their ID is the ArtistID
+type ForgottenResult struct {
+	ID          int64     `json:"id"`
+	ArtistID    int64     `json:"artistId"`
+	Artist      string    `json:"artist"`
+	Title       string    `json:"title,omitempty"`
+	PeakMonth   time.Time `json:"peakMonth"`
+	PeakPlays   int       `json:"peakPlays"`
+	TotalPlays  int       `json:"count"` // before the recent window
+	RecentPlays int       `json:"recentCount"`
+	LastPlayed  time.Time `json:"lastPlayed"`
+}
+
+// ForgottenFavorites are the artists and tracks that have been forgotten,
+// ranked by how many plays they had in their busiest month
+type ForgottenFavorites struct {
+	Artists []ForgottenResult `json:"artists"`
+	Tracks  []ForgottenResult `json:"tracks"`
+}
+
+// FindForgottenFavorites finds artists and tracks that had at least
+// MinPeak plays in a single month, but no more than MaxRecent in the
+// last Months months
+func FindForgottenFavorites(db *sql.DB, params ForgottenParams) (ForgottenFavorites, error) {
+	var res ForgottenFavorites
+	var err error
+
+	query := `select min(a.artist_id), min(a.artist_id), a.artist, '', ` + slotExpr + `, count(*), max(a.uts)
+	from activity a
+	where not ` + isExcluded + `
+	group by a.artist, ` + slotExpr + `;`
+
+	res.Artists, err = forgottenHelper(db, params, query)
+	if err != nil {
+		return res, err
+	}
+
+	query = `select min(a.id), min(a.artist_id), a.artist, a.title, ` + slotExpr + `, count(*), max(a.uts)
+	from activity a
+	where not ` + isExcluded + `
+	group by a.artist, a.title, ` + slotExpr + `;`
+
+	res.Tracks, err = forgottenHelper(db, params, query)
+	return res, err
+}
+
+// forgottenHelper runs a query for rows of (id, artist id, artist, title,
+// quarter hour slot, plays, last play) and picks out the forgotten favorites
+func forgottenHelper(db *sql.DB, params ForgottenParams, query string) ([]ForgottenResult, error) {
+	forgotten := []ForgottenResult{}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return forgotten, err
+	}
+	defer rows.Close()
+
+	since := params.Now.AddDate(0, -params.Months, 0)
+
+	type candidate struct {
+		ForgottenResult
+		monthly map[time.Time]int
+	}
+	candidates := map[string]*candidate{}
+	var order []string
+
+	for rows.Next() {
+		var r ForgottenResult
+		var slot, last int64
+		var count int
+		err = rows.Scan(&r.ID, &r.ArtistID, &r.Artist, &r.Title, &slot, &count, &last)
+		if err != nil {
+			return forgotten, err
+		}
+
+		// tab can't appear in tags scrobbled from last.fm
+		key := r.Artist + "\t" + r.Title
+		c, ok := candidates[key]
+		if !ok {
+			c = &candidate{ForgottenResult: r, monthly: map[time.Time]int{}}
+			candidates[key] = c
+			order = append(order, key)
+		}
+		if r.ID < c.ID {
+			c.ID = r.ID
+		}
+
+		when := slotTime(slot)
+		if when.Before(since) {
+			t := when.In(params.TZ)
+			c.monthly[time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, params.TZ)] += count
+			c.TotalPlays += count
+		} else {
+			c.RecentPlays += count
+		}
+		if lastPlayed := time.Unix(last, 0).In(params.TZ); lastPlayed.After(c.LastPlayed) {
+			c.LastPlayed = lastPlayed
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return forgotten, err
+	}
+
+	for _, key := range order {
+		c := candidates[key]
+		if c.RecentPlays > params.MaxRecent {
+			continue
+		}
+		for month, count := range c.monthly {
+			if count > c.PeakPlays || (count == c.PeakPlays && month.Before(c.PeakMonth)) {
+				c.PeakMonth = month
+				c.PeakPlays = count
+			}
+		}
+		if c.PeakPlays >= params.MinPeak {
+			forgotten = append(forgotten, c.ForgottenResult)
+		}
+	}
+
+	sort.SliceStable(forgotten, func(i, j int) bool {
+		if forgotten[i].PeakPlays != forgotten[j].PeakPlays {
+			return forgotten[i].PeakPlays > forgotten[j].PeakPlays
+		}
+		return forgotten[i].TotalPlays > forgotten[j].TotalPlays
+	})
+	if len(forgotten) > params.Limit {
+		forgotten = forgotten[:params.Limit]
+	}
+	return forgotten, nil
+}
@@ -0,0 +1,199 @@
+package query
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// milestones are round numbers of plays, overall and for each artist,
+// found by counting through activity in the order it was played
+
+// ScrobbleMilestones are the total play counts that are milestones
+var ScrobbleMilestones = []int{1, 1000, 5000, 10000, 25000, 50000, 100000, 250000, 500000, 1000000}
+
+// ArtistMilestones are the play counts of a single artist that are milestones
+var ArtistMilestones = []int{100, 250, 500, 1000, 2500, 5000}
+
+// MilestonePaceDays is how far back projections look for the pace
+// of listening
+const MilestonePaceDays = 90
+
+// Milestone is the play that reached a milestone. Like elsewhere the ID
+// is an activity id, which the track page accepts for any play
+type Milestone struct {
+	Count    int       `json:"count"`
+	When     time.Time `json:"when"`
+	ID       int64     `json:"id"`
+	ArtistID int64     `json:"artistId"`
+	Artist   string    `json:"artist"`
+	Title    string    `json:"title"`
+}
+
+// Projection estimates when a count will next reach a milestone at the
+// pace of the last MilestonePaceDays. When is nil if there's no pace
+type Projection struct {
+	ArtistID  int64      `json:"artistId,omitempty"`
+	Artist    string     `json:"artist,omitempty"`
+	Count     int        `json:"count"` // the milestone
+	Remaining int        `json:"remaining"`
+	PerDay    float64    `json:"perDay"`
+	When      *time.Time `json:"when,omitempty"`
+}
+
+// Milestones are all the milestones reached so far and projections
+// of the next ones
+type Milestones struct {
+	TotalPlays int `json:"count"`
+	// every scrobble milestone reached, oldest first
+	Scrobbles []Milestone `json:"scrobbles"`
+	// the first artist to reach each artist milestone
+	ArtistFirsts []Milestone `json:"artistFirsts"`
+	// artist milestones, newest first
+	Recent []Milestone `json:"recent"`
+	Next   Projection  `json:"next"`
+	// artists projected to reach their next milestone soonest
+	ArtistsNext []Projection `json:"artistsNext"`
+}
+
+// nextMilestone returns the first milestone above count, or 0 if
+// they've all been passed
+func nextMilestone(milestones []int, count int) int {
+	for _, m := range milestones {
+		if m > count {
+			return m
+		}
+	}
+	return 0
+}
+
+// project estimates when a count will reach its next milestone
+// given the number of plays during the pace window
+func project(milestones []int, count, recent int, now time.Time) Projection {
+	p := Projection{
+		Count:  nextMilestone(milestones, count),
+		PerDay: float64(recent) / MilestonePaceDays,
+	}
+	if p.Count == 0 {
+		return p
+	}
+	p.Remaining = p.Count - count
+	if p.PerDay > 0 {
+		when := now.Add(time.Duration(float64(p.Remaining) / p.PerDay * float64(24*time.Hour)))
+		p.When = &when
+	}
+	return p
+}
+
+// FindMilestones counts through every play to find the milestones
+// reached so far. limit caps the recent artist milestones and the
+// artist projections
+func FindMilestones(db *sql.DB, now time.Time, tz *time.Location, limit int) (Milestones, error) {
+	res := Milestones{
+		Scrobbles:    []Milestone{},
+		ArtistFirsts: []Milestone{},
+		Recent:       []Milestone{},
+		ArtistsNext:  []Projection{},
+	}
+
+	query := `select a.id, a.artist_id, a.artist, a.title, a.uts
+	from activity a
+	where not ` + isExcluded + `
+	order by a.uts, a.id;`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	type artistCount struct {
+		id            int64
+		count, recent int
+	}
+	artists := map[string]*artistCount{}
+	var order []string
+
+	scrobbles := map[int]bool{}
+	for _, m := range ScrobbleMilestones {
+		scrobbles[m] = true
+	}
+	reached := map[int]bool{}
+	for _, m := range ArtistMilestones {
+		reached[m] = false
+	}
+
+	paceStart := now.AddDate(0, 0, -MilestonePaceDays).Unix()
+	recent := 0
+
+	for rows.Next() {
+		var m Milestone
+		var uts int64
+		err = rows.Scan(&m.ID, &m.ArtistID, &m.Artist, &m.Title, &uts)
+		if err != nil {
+			return res, err
+		}
+		m.When = time.Unix(uts, 0).In(tz)
+
+		res.TotalPlays++
+		if scrobbles[res.TotalPlays] {
+			m.Count = res.TotalPlays
+			res.Scrobbles = append(res.Scrobbles, m)
+		}
+
+		a, ok := artists[m.Artist]
+		if !ok {
+			a = &artistCount{id: m.ArtistID}
+			artists[m.Artist] = a
+			order = append(order, m.Artist)
+		}
+		a.count++
+		if uts >= paceStart {
+			a.recent++
+			recent++
+		}
+
+		if first, ok := reached[a.count]; ok {
+			m.Count = a.count
+			res.Recent = append(res.Recent, m)
+			if !first {
+				res.ArtistFirsts = append(res.ArtistFirsts, m)
+				reached[a.count] = true
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	sort.SliceStable(res.Recent, func(i, j int) bool {
+		return res.Recent[i].When.After(res.Recent[j].When)
+	})
+	if len(res.Recent) > limit {
+		res.Recent = res.Recent[:limit]
+	}
+
+	res.Next = project(ScrobbleMilestones, res.TotalPlays, recent, now.In(tz))
+
+	for _, name := range order {
+		a := artists[name]
+		if a.recent == 0 {
+			continue
+		}
+		p := project(ArtistMilestones, a.count, a.recent, now.In(tz))
+		if p.When == nil {
+			continue
+		}
+		p.ArtistID = a.id
+		p.Artist = name
+		res.ArtistsNext = append(res.ArtistsNext, p)
+	}
+	sort.SliceStable(res.ArtistsNext, func(i, j int) bool {
+		return res.ArtistsNext[i].When.Before(*res.ArtistsNext[j].When)
+	})
+	if len(res.ArtistsNext) > limit {
+		res.ArtistsNext = res.ArtistsNext[:limit]
+	}
+
+	return res, nil
+}
@@ -0,0 +1,105 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFindMilestones(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// a minute apart: Broadcast's 100 plays, then Low's 1000, then 20
+	// other artists in turn. The last 900 plays are in the pace window
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	const total = 10050
+	const inWindow = 900
+	var plays []testPlay
+	for i := 0; i < total; i++ {
+		start, n := now.AddDate(0, 0, -200), i
+		if i >= total-inWindow {
+			start, n = now.AddDate(0, 0, -30), i-(total-inWindow)
+		}
+		artist := fmt.Sprintf("Artist %d", i%20)
+		if i < 100 {
+			artist = "Broadcast"
+		} else if i < 1100 {
+			artist = "Low"
+		}
+		plays = append(plays, testPlay{
+			uts:    start.Add(time.Duration(n) * time.Minute).Unix(),
+			artist: artist,
+			title:  fmt.Sprintf("Track %d", i),
+		})
+	}
+	storePlays(t, db, plays)
+
+	res, err := FindMilestones(db.SQL, now, time.UTC, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalPlays != total {
+		t.Errorf("total plays is %d, want %d", res.TotalPlays, total)
+	}
+
+	check := func(what string, got Milestone, count int, artist string, play int) {
+		if got.Count != count || got.Artist != artist || got.Title != fmt.Sprintf("Track %d", play) ||
+			got.When.Unix() != plays[play].uts {
+			t.Errorf("%s is %+v, want %s's play %d", what, got, artist, play)
+		}
+	}
+
+	if len(res.Scrobbles) != 4 {
+		t.Fatalf("got %d scrobble milestones, want 4", len(res.Scrobbles))
+	}
+	check("10,000th scrobble", res.Scrobbles[3], 10000, plays[9999].artist, 9999)
+
+	// Broadcast got to 100 first but Low got to everything after
+	firsts := []struct {
+		count  int
+		artist string
+		play   int
+	}{
+		{100, "Broadcast", 99}, {250, "Low", 349}, {500, "Low", 599}, {1000, "Low", 1099},
+	}
+	if len(res.ArtistFirsts) != len(firsts) {
+		t.Fatalf("got %d artist firsts, want %d", len(res.ArtistFirsts), len(firsts))
+	}
+	for i, f := range firsts {
+		check(fmt.Sprintf("first to %d", f.count), res.ArtistFirsts[i], f.count, f.artist, f.play)
+	}
+
+	if len(res.Recent) != 10 {
+		t.Errorf("got %d recent milestones, want 10", len(res.Recent))
+	}
+	for i := 1; i < len(res.Recent); i++ {
+		if res.Recent[i].When.After(res.Recent[i-1].When) {
+			t.Errorf("recent milestones aren't newest first")
+		}
+	}
+
+	// 900 plays in 90 days is 10 a day, so the remaining
+	// 14950 plays to 25000 take 1495 days
+	next := res.Next
+	if next.Count != 25000 || next.Remaining != 25000-total || next.PerDay != 10 ||
+		next.When == nil || !next.When.Equal(now.AddDate(0, 0, 1495)) {
+		t.Errorf("next scrobble milestone is %+v", next)
+	}
+
+	// the other artists each have 45 plays in the window, and the first
+	// ten have 448 plays so far. Broadcast and Low have no pace
+	if len(res.ArtistsNext) != 10 {
+		t.Fatalf("got %d artist projections, want 10", len(res.ArtistsNext))
+	}
+	first := res.ArtistsNext[0]
+	if first.Artist != "Artist 0" || first.Count != 500 || first.Remaining != 52 ||
+		first.When == nil || !first.When.Equal(now.AddDate(0, 0, 104)) {
+		t.Errorf("first artist projection is %+v", first)
+	}
+	for _, p := range res.ArtistsNext {
+		if p.Artist == "Broadcast" || p.Artist == "Low" {
+			t.Errorf("%s is projected without any recent plays", p.Artist)
+		}
+	}
+}
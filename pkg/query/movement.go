@@ -0,0 +1,251 @@
+package query
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// chart movement between two periods, like the arrows next to a
+// singles chart. "new" entries have never been played before the
+// period, "re-entries" have been played but weren't in the previous
+// chart
+
+// Movement statuses
+const (
+	MovementUp      = "up"
+	MovementDown    = "down"
+	MovementSame    = "same"
+	MovementNew     = "new"
+	MovementReentry = "reentry"
+)
+
+// Movement describes how a chart entry's position changed since the
+// previous period. Delta is positive when the entry climbed, and both
+// PrevRank and Delta are 0 for new entries and re-entries
+type Movement struct {
+	Status   string `json:"status"`
+	PrevRank int    `json:"prevRank"`
+	Delta    int    `json:"delta"`
+}
+
+// Places is the number of places moved, in either direction
+func (m Movement) Places() int {
+	if m.Delta < 0 {
+		return -m.Delta
+	}
+	return m.Delta
+}
+
+// TrackChart is a track chart compared with the previous period
+type TrackChart struct {
+	Tracks   []TrackResult `json:"tracks"`
+	Dropouts []TrackResult `json:"dropouts"` // ranked by their previous position
+}
+
+// ArtistChart is an artist chart compared with the previous period
+type ArtistChart struct {
+	Artists  []ArtistResult `json:"artists"`
+	Dropouts []ArtistResult `json:"dropouts"` // ranked by their previous position
+}
+
+// chartMovement compares two charts given as lists of keys in rank
+// order. Entries that weren't in the previous chart get an empty status,
+// to be filled in by the caller. The indexes of previous entries missing
+// from the current chart are returned as dropouts
+func chartMovement(current, previous []string) ([]Movement, []int) {
+	moves := make([]Movement, len(current))
+	var dropouts []int
+
+	prevRanks := map[string]int{}
+	for i, key := range previous {
+		prevRanks[key] = i + 1
+	}
+	currentKeys := map[string]bool{}
+
+	for i, key := range current {
+		currentKeys[key] = true
+
+		prevRank, ok := prevRanks[key]
+		if !ok {
+			continue
+		}
+		rank := i + 1
+		moves[i] = Movement{PrevRank: prevRank, Delta: prevRank - rank}
+		switch {
+		case rank < prevRank:
+			moves[i].Status = MovementUp
+		case rank > prevRank:
+			moves[i].Status = MovementDown
+		default:
+			moves[i].Status = MovementSame
+		}
+	}
+
+	for i, key := range previous {
+		if !currentKeys[key] {
+			dropouts = append(dropouts, i)
+		}
+	}
+	return moves, dropouts
+}
+
+// firstPlays finds when each of a list of candidates was first played.
+// A candidate is a value for each of columns of activity (aliased as
+// "a"), and the result is keyed by the values joined with tabs, like the
+// chart keys. Candidates that were never played are left out
+func firstPlays(db *sql.DB, columns []string, candidates [][]string) (map[string]time.Time, error) {
+	first := map[string]time.Time{}
+	if len(candidates) == 0 {
+		return first, nil
+	}
+
+	cols := strings.Join(columns, ", ")
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := strings.TrimSuffix(strings.Repeat(row+", ", len(candidates)), ", ")
+	query := `select ` + cols + `, min(a.uts)
+	from activity a
+	where (` + cols + `) in (values ` + values + `)
+	and not ` + isExcluded + `
+	group by ` + cols + `;`
+
+	var args []interface{}
+	for _, c := range candidates {
+		for _, v := range c {
+			args = append(args, v)
+		}
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return first, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		vals := make([]string, len(columns))
+		dest := make([]interface{}, len(columns)+1)
+		for i := range vals {
+			dest[i] = &vals[i]
+		}
+		var uts int64
+		dest[len(columns)] = &uts
+		err = rows.Scan(dest...)
+		if err != nil {
+			return first, err
+		}
+		first[strings.Join(vals, "\t")] = time.Unix(uts, 0)
+	}
+	return first, rows.Err()
+}
+
+// playedBefore reports whether the candidate with key was
+// played before start, given the result of firstPlays
+func playedBefore(first map[string]time.Time, key string, start time.Time) bool {
+	t, ok := first[key]
+	return ok && t.Before(start)
+}
+
+// newOrReentry decides between the two statuses for
+// an entry that wasn't in the previous chart
+func newOrReentry(played bool) string {
+	if played {
+		return MovementReentry
+	}
+	return MovementNew
+}
+
+// CompareTopTracks finds the top tracks for the current period
+// along with their movement since the previous one
+func CompareTopTracks(db *sql.DB, current, previous DateRangeParams) (TrackChart, error) {
+	chart := TrackChart{Tracks: []TrackResult{}, Dropouts: []TrackResult{}}
+
+	tracks, err := TopTracks(db, current)
+	if err != nil {
+		return chart, err
+	}
+	prevTracks, err := TopTracks(db, previous)
+	if err != nil {
+		return chart, err
+	}
+
+	// tab can't appear in tags scrobbled from last.fm
+	key := func(t TrackResult) string { return t.Artist + "\t" + t.Title }
+	var keys, prevKeys []string
+	for _, t := range tracks {
+		keys = append(keys, key(t))
+	}
+	for _, t := range prevTracks {
+		prevKeys = append(prevKeys, key(t))
+	}
+
+	moves, dropouts := chartMovement(keys, prevKeys)
+	var entries [][]string
+	for i, t := range tracks {
+		if moves[i].Status == "" {
+			entries = append(entries, []string{t.Artist, t.Title})
+		}
+	}
+	first, err := firstPlays(db, []string{"a.artist", "a.title"}, entries)
+	if err != nil {
+		return chart, err
+	}
+	for i := range tracks {
+		if moves[i].Status == "" {
+			moves[i].Status = newOrReentry(playedBefore(first, keys[i], current.Start))
+		}
+		tracks[i].Movement = &moves[i]
+		chart.Tracks = append(chart.Tracks, tracks[i])
+	}
+	for _, i := range dropouts {
+		chart.Dropouts = append(chart.Dropouts, prevTracks[i])
+	}
+
+	return chart, nil
+}
+
+// CompareTopArtists finds the top artists for the current period
+// along with their movement since the previous one
+func CompareTopArtists(db *sql.DB, current, previous DateRangeParams) (ArtistChart, error) {
+	chart := ArtistChart{Artists: []ArtistResult{}, Dropouts: []ArtistResult{}}
+
+	artists, err := TopArtists(db, current)
+	if err != nil {
+		return chart, err
+	}
+	prevArtists, err := TopArtists(db, previous)
+	if err != nil {
+		return chart, err
+	}
+
+	var keys, prevKeys []string
+	for _, a := range artists {
+		keys = append(keys, a.Name)
+	}
+	for _, a := range prevArtists {
+		prevKeys = append(prevKeys, a.Name)
+	}
+
+	moves, dropouts := chartMovement(keys, prevKeys)
+	var entries [][]string
+	for i, a := range artists {
+		if moves[i].Status == "" {
+			entries = append(entries, []string{a.Name})
+		}
+	}
+	first, err := firstPlays(db, []string{"a.artist"}, entries)
+	if err != nil {
+		return chart, err
+	}
+	for i := range artists {
+		if moves[i].Status == "" {
+			moves[i].Status = newOrReentry(playedBefore(first, keys[i], current.Start))
+		}
+		artists[i].Movement = &moves[i]
+		chart.Artists = append(chart.Artists, artists[i])
+	}
+	for _, i := range dropouts {
+		chart.Dropouts = append(chart.Dropouts, prevArtists[i])
+	}
+
+	return chart, nil
+}
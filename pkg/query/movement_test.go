@@ -0,0 +1,88 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChartMovement(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	var plays []testPlay
+	add := func(month time.Month, artist string, n int) {
+		start := time.Date(2024, month, 10, 12, 0, 0, 0, time.UTC)
+		for i := 0; i < n; i++ {
+			plays = append(plays, testPlay{
+				uts:    start.Add(time.Duration(len(plays)) * 5 * time.Minute).Unix(),
+				artist: artist,
+				title:  artist + " Song",
+			})
+		}
+	}
+	add(time.January, "Stereolab", 1)
+	add(time.February, "Low", 3)
+	add(time.February, "Broadcast", 2)
+	add(time.February, "Radiohead", 1)
+	add(time.March, "Broadcast", 4)
+	add(time.March, "Low", 3)
+	add(time.March, "Stereolab", 2)
+	add(time.March, "Slowdive", 1)
+	storePlays(t, db, plays)
+
+	current, err := CustomDateRange("2024-03-01", "2024-03-31", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := CustomDateRange("2024-02-01", "2024-02-29", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Limit, previous.Limit = 10, 10
+
+	want := []struct {
+		artist string
+		move   Movement
+	}{
+		{"Broadcast", Movement{Status: MovementUp, PrevRank: 2, Delta: 1}},
+		{"Low", Movement{Status: MovementDown, PrevRank: 1, Delta: -1}},
+		{"Stereolab", Movement{Status: MovementReentry}},
+		{"Slowdive", Movement{Status: MovementNew}},
+	}
+
+	artists, err := CompareTopArtists(db.SQL, current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks, err := CompareTopTracks(db.SQL, current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artists.Artists) != len(want) || len(tracks.Tracks) != len(want) {
+		t.Fatalf("got %d artists and %d tracks, want %d", len(artists.Artists), len(tracks.Tracks), len(want))
+	}
+	for i, w := range want {
+		if a := artists.Artists[i]; a.Name != w.artist || *a.Movement != w.move {
+			t.Errorf("artist %d is %s %+v, want %s %+v", i, a.Name, *a.Movement, w.artist, w.move)
+		}
+		if tr := tracks.Tracks[i]; tr.Artist != w.artist || *tr.Movement != w.move {
+			t.Errorf("track %d is by %s %+v, want %s %+v", i, tr.Artist, *tr.Movement, w.artist, w.move)
+		}
+	}
+
+	if len(artists.Dropouts) != 1 || artists.Dropouts[0].Name != "Radiohead" {
+		t.Errorf("artist dropouts are %+v", artists.Dropouts)
+	}
+	if len(tracks.Dropouts) != 1 || tracks.Dropouts[0].Artist != "Radiohead" {
+		t.Errorf("track dropouts are %+v", tracks.Dropouts)
+	}
+
+	// on the day in march only Slowdive's track is a first listen
+	day, err := DayHistoryFor(db.SQL, time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC), time.UTC, DefaultSessionGap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(day.FirstListens) != 1 || day.FirstListens[0].Artist != "Slowdive" {
+		t.Errorf("first listens are %+v", day.FirstListens)
+	}
+}
@@ -0,0 +1,103 @@
+package query
+
+import (
+	"database/sql"
+	"time"
+)
+
+// OnThisDayYears are how many years ago OnThisDay looks back
+var OnThisDayYears = []int{1, 2, 5, 10}
+
+// number of top artists and tracks in a day's history
+const dayHistoryLimit = 5
+
+// DayHistory is what was played on a single calendar day
+type DayHistory struct {
+	YearsAgo     int              `json:"yearsAgo"`
+	Date         time.Time        `json:"date"`
+	PlayCount    int              `json:"count"`
+	TopArtists   []ArtistResult   `json:"topArtists"`
+	TopTracks    []TrackResult    `json:"topTracks"`
+	FirstListens []ActivityResult `json:"firstListens"` // first ever play of a track
+	Sessions     []Session        `json:"sessions"`     // cut off at midnight
+}
+
+// DayHistoryFor collects what was played on the calendar day in tz that
+// contains day, splitting sessions by gap
+func DayHistoryFor(db *sql.DB, day time.Time, tz *time.Location, gap time.Duration) (DayHistory, error) {
+	start := dayStart(day, tz)
+	res := DayHistory{
+		Date:         start,
+		TopArtists:   []ArtistResult{},
+		TopTracks:    []TrackResult{},
+		FirstListens: []ActivityResult{},
+		Sessions:     []Session{},
+	}
+
+	plays, err := DayPlays(db, start, tz)
+	if err != nil || len(plays) == 0 {
+		return res, err
+	}
+	res.PlayCount = len(plays)
+	res.Sessions = sessionize(plays, gap)
+
+	params := DateRangeParams{
+		Mode:  "day",
+		Start: start,
+		End:   start.AddDate(0, 0, 1),
+		Limit: dayHistoryLimit,
+		TZ:    tz,
+	}
+	res.TopArtists, err = TopArtists(db, params)
+	if err != nil {
+		return res, err
+	}
+	res.TopTracks, err = TopTracks(db, params)
+	if err != nil {
+		return res, err
+	}
+
+	// tab can't appear in tags scrobbled from last.fm
+	seen := map[string]bool{}
+	var tracks [][]string
+	for _, p := range plays {
+		key := p.Artist + "\t" + p.Title
+		if !seen[key] {
+			seen[key] = true
+			tracks = append(tracks, []string{p.Artist, p.Title})
+		}
+	}
+	first, err := firstPlays(db, []string{"a.artist", "a.title"}, tracks)
+	if err != nil {
+		return res, err
+	}
+	listed := map[string]bool{}
+	for _, p := range plays {
+		key := p.Artist + "\t" + p.Title
+		if listed[key] || playedBefore(first, key, start) {
+			continue
+		}
+		listed[key] = true
+		res.FirstListens = append(res.FirstListens, p)
+	}
+
+	return res, nil
+}
+
+// OnThisDay collects what was played on the same date as now in each of
+// OnThisDayYears, most recent first. February 29th falls back to
+// March 1st in years that don't have one
+func OnThisDay(db *sql.DB, now time.Time, tz *time.Location, gap time.Duration) ([]DayHistory, error) {
+	var history []DayHistory
+
+	today := dayStart(now, tz)
+	for _, years := range OnThisDayYears {
+		day, err := DayHistoryFor(db, today.AddDate(-years, 0, 0), tz, gap)
+		if err != nil {
+			return history, err
+		}
+		day.YearsAgo = years
+		history = append(history, day)
+	}
+	return history, nil
+}
@@ -4,8 +4,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
 )
 
 type OffsetParams struct {
@@ -18,10 +21,11 @@ type DateRangeParams struct {
 	Mode   string
 	Offset int
 	// generated fields
-	Start time.Time
-	End   time.Time
-	Limit int
-	TZ    *time.Location
+	Start     time.Time
+	End       time.Time
+	Limit     int
+	TZ        *time.Location
+	WeekStart time.Weekday // first day of a calendar week
 }
 
 // StartString returns a sqlite-compatible string with second granularity
@@ -36,28 +40,49 @@ func (dp DateRangeParams) EndString() string {
 
 // ArtistResult contains popularity metrics about an artist
 type ArtistResult struct {
-	Rank      int      `json:"rank"`
-	Name      string   `json:"artist"`
-	PlayCount int      `json:"count"` // XXX rename in json also
-	ImageURLs []string `json:"urls"`
+	Rank      int       `json:"rank"`
+	ID        int64     `json:"id"`
+	Name      string    `json:"artist"`
+	PlayCount int       `json:"count"` // XXX rename in json also
+	ImageURLs []string  `json:"urls"`
+	Movement  *Movement `json:"movement,omitempty"` // only set by CompareTopArtists
+	// only set by TopNewArtists
+	FirstPlayed *time.Time `json:"firstPlayed,omitempty"`
 }
 
 // TrackResult track popularity for a given time period
 type TrackResult struct {
-	Rank      int      `json:"rank"` // display order
+	Rank      int       `json:"rank"` // display order
+	ID        int64     `json:"id"`   // see TrackDetail
+	ArtistID  int64     `json:"artistId"`
+	Artist    string    `json:"artist"`
+	Title     string    `json:"title"`
+	PlayCount int       `json:"count"`
+	ImageURLs []string  `json:"urls"`
+	Movement  *Movement `json:"movement,omitempty"` // only set by CompareTopTracks
+}
+
+// AlbumResult album popularity for a given time period
+type AlbumResult struct {
+	Rank      int      `json:"rank"`
+	ID        int64    `json:"id"`
 	Artist    string   `json:"artist"`
-	Title     string   `json:"title"`
+	Album     string   `json:"album"`
 	PlayCount int      `json:"count"`
 	ImageURLs []string `json:"urls"`
 }
 
 // ActivityResult represents a single track being played
 type ActivityResult struct {
+	ID        int64     `json:"id"`
+	ArtistID  int64     `json:"artistId"`
+	AlbumID   int64     `json:"albumId"`
 	Title     string    `json:"title"`
 	Artist    string    `json:"artist"`
 	Album     string    `json:"album"`
 	Time      time.Time `json:"when"`
 	ImageURLs []string  `json:"urls"`
+	Excluded  bool      `json:"excluded"` // matches the exclusion list
 }
 
 // ClockResult holds hourly listening metrics, representing what time
@@ -68,8 +93,14 @@ type ClockResult struct {
 	AvgCount  int `json:"avgCount"`
 }
 
+// isExcluded is true for activity rows (aliased as "a") on the exclusion
+// list. Excluded plays are still stored, but every statistics query
+// filters them out with "and not " + isExcluded
+const isExcluded = m.ExcludedActivity
+
 // RecentTracks finds the most recently played tracks, with a simple page
-// offset and count
+// offset and count. Unlike the other queries this includes excluded
+// tracks, which are flagged so they can be displayed differently
 func RecentTracks(db *sql.DB, trackOffset, count int) ([]ActivityResult, error) {
 
 	if trackOffset < 0 {
@@ -82,7 +113,7 @@ func RecentTracks(db *sql.DB, trackOffset, count int) ([]ActivityResult, error)
 
 	var tracks []ActivityResult
 
-	query := `select a.artist, a.title, a.album, a.dt, i.url
+	query := `select a.id, a.artist_id, a.album_id, a.artist, a.title, a.album, a.dt, i.url, ` + isExcluded + `
 	from activity a
 	left join image i on a.image_id = i.id
 	order by a.dt desc limit ? offset ?;`
@@ -100,7 +131,8 @@ func RecentTracks(db *sql.DB, trackOffset, count int) ([]ActivityResult, error)
 		var maybeImg sql.NullString
 		res := ActivityResult{}
 
-		err = rows.Scan(&res.Artist, &res.Title, &res.Album, &res.Time, &maybeImg)
+		err = rows.Scan(&res.ID, &res.ArtistID, &res.AlbumID, &res.Artist, &res.Title, &res.Album,
+			&res.Time, &maybeImg, &res.Excluded)
 		if err != nil {
 			return tracks, err
 		}
@@ -120,16 +152,29 @@ func RecentTracks(db *sql.DB, trackOffset, count int) ([]ActivityResult, error)
 // TopTracks finds the most popular tracks by play count over
 // a bounded time period
 func TopTracks(db *sql.DB, params DateRangeParams) ([]TrackResult, error) {
-	var tracks []TrackResult
+	if coversRollupDay(params.Start, params.End) {
+		return topTracksRollup(db, params)
+	}
+	return topTracksActivity(db, params)
+}
 
-	query := `select a.artist, a.title, count(*) as plays, group_concat(distinct i.url)
+func topTracksActivity(db *sql.DB, params DateRangeParams) ([]TrackResult, error) {
+	query := `select min(a.id), min(a.artist_id), a.artist, a.title, count(*) as plays, group_concat(distinct i.url)
 	from activity a
 	left join image i on a.image_id = i.id
-	where a.dt >= ? and a.dt < ?
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `
 	group by a.artist, a.title
-	order by plays desc limit ?;`
+	order by plays desc, a.artist, a.title limit ?;`
+
+	return scanTopTracks(db.Query(query, params.Start.Unix(), params.End.Unix(), params.Limit))
+}
+
+// scanTopTracks reads rows of (track id, artist id, artist, title, plays, image urls)
+// from either the activity or rollup version of the query
+func scanTopTracks(rows *sql.Rows, err error) ([]TrackResult, error) {
+	var tracks []TrackResult
 
-	rows, err := db.Query(query, params.Start, params.End, params.Limit)
 	if err != nil {
 		return tracks, err
 	}
@@ -141,7 +186,7 @@ func TopTracks(db *sql.DB, params DateRangeParams) ([]TrackResult, error) {
 		var groupConcat sql.NullString
 		res := TrackResult{}
 
-		err = rows.Scan(&res.Artist, &res.Title, &res.PlayCount, &groupConcat)
+		err = rows.Scan(&res.ID, &res.ArtistID, &res.Artist, &res.Title, &res.PlayCount, &groupConcat)
 		if err != nil {
 			return tracks, err
 		}
@@ -162,31 +207,46 @@ func TopTracks(db *sql.DB, params DateRangeParams) ([]TrackResult, error) {
 // TopArtists finds the most popular artists by play count over
 // a bounded time period
 func TopArtists(db *sql.DB, params DateRangeParams) ([]ArtistResult, error) {
+	if coversRollupDay(params.Start, params.End) {
+		return topArtistsRollup(db, params)
+	}
+	return topArtistsActivity(db, params)
+}
 
-	var artists []ArtistResult
-
-	query := `select a.artist, count(*) as plays, group_concat(distinct i.url)
+func topArtistsActivity(db *sql.DB, params DateRangeParams) ([]ArtistResult, error) {
+	query := `select min(a.artist_id), a.artist, count(*) as plays, group_concat(distinct i.url)
 	from activity a
 	left join image i on a.image_id = i.id
-	where a.dt >= ? and a.dt < ?
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `
 	group by a.artist
-	order by plays desc limit ?;`
+	order by plays desc, a.artist limit ?;`
+
+	return scanTopArtists(db.Query(query, params.Start.Unix(), params.End.Unix(), params.Limit))
+}
+
+// scanTopArtists reads rows of (artist id, artist, plays, image urls) from
+// either the activity or rollup version of the query
+func scanTopArtists(rows *sql.Rows, err error) ([]ArtistResult, error) {
+	var artists []ArtistResult
 
-	rows, err := db.Query(query, params.Start, params.End, params.Limit)
 	if err != nil {
 		return artists, err
 	}
 	defer rows.Close()
 
+	i := 0
 	for rows.Next() {
+		i++
 		var groupConcat sql.NullString
 		res := ArtistResult{}
 
-		err = rows.Scan(&res.Name, &res.PlayCount, &groupConcat)
+		err = rows.Scan(&res.ID, &res.Name, &res.PlayCount, &groupConcat)
 		if err != nil {
 			return artists, err
 		}
 
+		res.Rank = i
 		if groupConcat.Valid {
 			res.ImageURLs = strings.Split(groupConcat.String, ",")
 		} else {
@@ -199,39 +259,115 @@ func TopArtists(db *sql.DB, params DateRangeParams) ([]ArtistResult, error) {
 	return artists, nil
 }
 
+// TopAlbums finds the most popular albums by play count over
+// a bounded time period. Plays without an album aren't counted
+func TopAlbums(db *sql.DB, params DateRangeParams) ([]AlbumResult, error) {
+	// the album table is keyed by name alone, so albums are identified by
+	// the id of one of their plays instead, like tracks (see AlbumHistory)
+	query := `select min(a.id), a.artist, a.album, count(*) as plays, group_concat(distinct i.url)
+	from activity a
+	left join image i on a.image_id = i.id
+	where a.uts >= ? and a.uts < ?
+	and a.album != ''
+	and not ` + isExcluded + `
+	group by a.artist, a.album
+	order by plays desc, a.artist, a.album limit ?;`
+
+	return scanTopAlbums(db.Query(query, params.Start.Unix(), params.End.Unix(), params.Limit))
+}
+
+// scanTopAlbums reads rows of (play id, artist, album, plays, image urls)
+func scanTopAlbums(rows *sql.Rows, err error) ([]AlbumResult, error) {
+	var albums []AlbumResult
+
+	if err != nil {
+		return albums, err
+	}
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		i++
+		var groupConcat sql.NullString
+		res := AlbumResult{}
+
+		err = rows.Scan(&res.ID, &res.Artist, &res.Album, &res.PlayCount, &groupConcat)
+		if err != nil {
+			return albums, err
+		}
+
+		res.Rank = i
+		if groupConcat.Valid {
+			res.ImageURLs = strings.Split(groupConcat.String, ",")
+		} else {
+			res.ImageURLs = []string{}
+		}
+
+		albums = append(albums, res)
+	}
+
+	return albums, nil
+}
+
 // TopNewArtists finds the most popular new artists by play count over
 // a bounded time period. "new" means the artist was first played during
-// this time period
+// this time period, and like Discover's artists, only plays during it
+// count towards the threshold
 func TopNewArtists(db *sql.DB, params DateRangeParams) ([]ArtistResult, error) {
+	return NewArtists(db, params, DefaultDiscoveryParams().MinArtistPlays)
+}
 
-	var artists []ArtistResult
+// NewArtists is TopNewArtists with a minimum number of plays during the
+// period, the same artists Discover finds with that MinArtistPlays. Each
+// artist's FirstPlayed is the time of their first play, in params.TZ
+func NewArtists(db *sql.DB, params DateRangeParams, minPlays int) ([]ArtistResult, error) {
+	artists, err := topNewArtistsRollup(db, params, minPlays)
+	for i := range artists {
+		first := artists[i].FirstPlayed.In(params.TZ)
+		artists[i].FirstPlayed = &first
+	}
+	return artists, err
+}
 
+func topNewArtistsActivity(db *sql.DB, params DateRangeParams, minPlays int) ([]ArtistResult, error) {
 	// min(image_id) is used just to choose a single image
-	query := `select a.artist, a.plays, a.first, i.url from
-	(select artist, count(*) as plays, min(dt) as first, min(image_id) as img_id
-	from activity
+	query := `select a.artist_id, a.artist, a.plays, a.first, i.url from
+	(select min(artist_id) as artist_id, artist, sum(uts < ?) as plays, min(uts) as first, min(image_id) as img_id
+	from activity a
+	where not ` + isExcluded + `
 	group by artist
-	having min(dt) >= ?
-	and min(dt) < ?
-	and count(*) > ?) a
+	having min(uts) >= ?
+	and min(uts) < ?) a
 	left join image i on i.id = a.img_id
-	order by a.plays desc;`
+	where a.plays >= ?
+	order by a.plays desc, a.artist;`
+
+	end := params.End.Unix()
+	return scanTopNewArtists(db.Query(query, end, params.Start.Unix(), end, minPlays))
+}
+
+// scanTopNewArtists reads rows of (artist id, artist, plays, first play as
+// a unix time, image url) from either the activity or rollup version of
+// the query
+func scanTopNewArtists(rows *sql.Rows, err error) ([]ArtistResult, error) {
+	var artists []ArtistResult
 
-	rows, err := db.Query(query, params.Start, params.End, 3) // 3 plays is arbitrary
 	if err != nil {
 		return artists, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		tmp := "" // ignore the initial date for now
+		var first int64
 		var imageURL sql.NullString
 		res := ArtistResult{}
 
-		err = rows.Scan(&res.Name, &res.PlayCount, &tmp, &imageURL)
+		err = rows.Scan(&res.ID, &res.Name, &res.PlayCount, &first, &imageURL)
 		if err != nil {
 			return artists, err
 		}
+		firstPlayed := time.Unix(first, 0)
+		res.FirstPlayed = &firstPlayed
 
 		if imageURL.Valid {
 			res.ImageURLs = strings.Split(imageURL.String, ",")
@@ -250,47 +386,75 @@ func listeningClockHelper(db *sql.DB, start, end time.Time, tz *time.Location) (
 
 	var counts [24]int
 
-	query := `select strftime('%Y-%m-%d %H:00', dt) as hour, count(*) as c
-	from activity
-	where dt >= ? and dt < ?
-	group by 1
-	order by 1;`
+	rowCount := 0
+	err := forEachSlot(db, start, end, func(slot time.Time, count int) {
+		// convert from UTC to the user timezone
+		counts[slot.In(tz).Hour()] += count
+		rowCount++
+	})
+	fmt.Printf("listeningClockHelper processed %d rows\n", rowCount)
+	return counts, err
+}
+
+// forEachSlot calls fn with the start of every quarter hour in a date
+// range that has plays, along with the number of plays in it. Quarter
+// hours never straddle a local hour, see m.QuarterHour
+func forEachSlot(db *sql.DB, start, end time.Time, fn func(slot time.Time, count int)) error {
+
+	var rows *sql.Rows
+	var err error
 
-	rows, err := db.Query(query, start, end)
+	if slotAligned(start, end) {
+		rows, err = slotCountsRollup(db, start, end)
+	} else {
+		rows, err = slotCountsActivity(db, start, end)
+	}
 	if err != nil {
-		return counts, err
+		return err
 	}
 	defer rows.Close()
 
-	rowCount := 0
 	for rows.Next() {
-		var hourStr string
+		var slot int64
 		count := 0
 
-		err = rows.Scan(&hourStr, &count)
+		err = rows.Scan(&slot, &count)
 		if err != nil {
-			return counts, err
+			return err
 		}
+		fn(slotTime(slot), count)
+	}
+	return rows.Err()
+}
 
-		// need to manually parse the time string
-		hour, err := time.Parse("2006-01-02 15:04", hourStr)
-		if err != nil {
-			return counts, err
-		}
-		// and then convert from UTC to the user timezone
-		if tz != time.UTC {
-			hour = hour.In(tz)
-		}
+// slotExpr is the quarter hour a play on activity (aliased as "a") falls
+// in. Plays are counted per slot in sql and sorted into local hours, days
+// and months in Go, since a utc hour can straddle two local ones in
+// timezones that are a half or quarter hour off utc, see m.QuarterHour
+var slotExpr = "a.uts / " + strconv.Itoa(m.QuarterHour)
 
-		//fmt.Printf("%v %d\n", hour, count)
+// slotTime is the start of a quarter hour slot
+func slotTime(slot int64) time.Time {
+	return time.Unix(slot*m.QuarterHour, 0)
+}
 
-		counts[hour.Hour()] += count
-		rowCount++
-	}
-	fmt.Printf("listeningClockHelper processed %d rows\n", rowCount)
-	return counts, nil
+// slotCountsActivity finds (quarter hour slot, play count)
+// rows over a date range
+func slotCountsActivity(db *sql.DB, start, end time.Time) (*sql.Rows, error) {
+	query := `select ` + slotExpr + `, count(*) as c
+	from activity a
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `
+	group by 1
+	order by 1;`
+
+	return db.Query(query, start.Unix(), end.Unix())
 }
 
+// ClockAvgPeriods is the number of periods before a date range
+// that ListeningClock averages over
+const ClockAvgPeriods = 6
+
 func ListeningClock(db *sql.DB, params DateRangeParams) ([]ClockResult, error) {
 
 	// allocate the memory for the result and fill in the hours
@@ -311,15 +475,8 @@ func ListeningClock(db *sql.DB, params DateRangeParams) ([]ClockResult, error) {
 
 	// average the n preceding periods
 	// end on the start of the current "regular" period
-	const avgPeriod int = 6
-	var avgStart time.Time
-	if params.Mode == "week" {
-		avgStart = params.Start.AddDate(0, 0, -7*avgPeriod)
-	} else if params.Mode == "month" {
-		avgStart = params.Start.AddDate(0, -avgPeriod, 0)
-	} else if params.Mode == "year" {
-		avgStart = params.Start.AddDate(-avgPeriod, 0, 0)
-	}
+	const avgPeriod int = ClockAvgPeriods
+	avgStart := params.PeriodsBefore(avgPeriod)
 
 	fmt.Printf("[[ %v - %v ]]\n", avgStart, params.Start)
 	avgCount, err := listeningClockHelper(db, avgStart, params.Start, params.TZ)
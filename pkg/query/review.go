@@ -0,0 +1,213 @@
+package query
+
+import (
+	"database/sql"
+	"time"
+)
+
+// a year review gathers the highlights of a calendar year,
+// like the year end summaries streaming services send out
+
+// number of artists, albums, tracks and discoveries in a year review
+const yearReviewLimit = 10
+
+// YearTotals are the overall numbers for a year. Minutes is the total
+// length of the year's listening sessions
+type YearTotals struct {
+	PlayCount     int `json:"count"`
+	Minutes       int `json:"minutes"`
+	UniqueArtists int `json:"uniqueArtists"`
+	UniqueTracks  int `json:"uniqueTracks"`
+	NewArtists    int `json:"newArtists"`
+}
+
+// MonthReview is the listening in one month of a year review
+type MonthReview struct {
+	Start     time.Time `json:"start"`
+	PlayCount int       `json:"count"`
+	Minutes   int       `json:"minutes"`
+}
+
+// ReplayResult is a track played over and over on a single day
+type ReplayResult struct {
+	ID        int64     `json:"id"` // see TrackDetail
+	ArtistID  int64     `json:"artistId"`
+	Artist    string    `json:"artist"`
+	Title     string    `json:"title"`
+	Day       time.Time `json:"day"`
+	PlayCount int       `json:"count"`
+}
+
+// YearReviewResult is everything in a review of a calendar year.
+// LongestSession and MostReplayed are nil if nothing was played
+type YearReviewResult struct {
+	Year           int            `json:"year"`
+	Totals         YearTotals     `json:"totals"`
+	Previous       YearTotals     `json:"previous"` // the year before
+	TopArtists     []ArtistResult `json:"topArtists"`
+	TopAlbums      []AlbumResult  `json:"topAlbums"`
+	TopTracks      []TrackResult  `json:"topTracks"`
+	Monthly        []MonthReview  `json:"monthly"`
+	BusiestDay     PeriodCount    `json:"busiestDay"`
+	Discoveries    Discoveries    `json:"discoveries"`
+	LongestSession *Session       `json:"longestSession"`
+	MostReplayed   *ReplayResult  `json:"mostReplayed"`
+}
+
+// yearParams is the date range covering a calendar year in tz
+func yearParams(year int, tz *time.Location) DateRangeParams {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, tz)
+	return DateRangeParams{
+		Mode:  "year",
+		Start: start,
+		End:   start.AddDate(1, 0, 0),
+		Limit: yearReviewLimit,
+		TZ:    tz,
+	}
+}
+
+// yearTotals adds up the overall numbers for a year, returning its
+// sessions (split by gap) as well
+func yearTotals(db *sql.DB, params DateRangeParams, gap time.Duration) (YearTotals, []Session, error) {
+	var totals YearTotals
+
+	diversity, err := Diversity(db, params)
+	if err != nil {
+		return totals, nil, err
+	}
+	totals.PlayCount = diversity.PlayCount
+	totals.UniqueArtists = diversity.UniqueArtists
+	totals.UniqueTracks = diversity.UniqueTracks
+
+	newArtists, err := NewArtists(db, params, 1)
+	if err != nil {
+		return totals, nil, err
+	}
+	totals.NewArtists = len(newArtists)
+
+	sessions, err := Sessions(db, params, gap)
+	if err != nil {
+		return totals, sessions, err
+	}
+	for _, s := range sessions {
+		totals.Minutes += s.Minutes
+	}
+	return totals, sessions, nil
+}
+
+// YearReview reviews a calendar year in tz, comparing it with the year
+// before. Listening time and the longest session use sessions split by gap
+func YearReview(db *sql.DB, year int, tz *time.Location, gap time.Duration) (YearReviewResult, error) {
+	res := YearReviewResult{Year: year}
+	params := yearParams(year, tz)
+
+	var sessions []Session
+	var err error
+	res.Totals, sessions, err = yearTotals(db, params, gap)
+	if err != nil {
+		return res, err
+	}
+	res.Previous, _, err = yearTotals(db, yearParams(year-1, tz), gap)
+	if err != nil {
+		return res, err
+	}
+	res.LongestSession = SummarizeSessions(sessions).Longest
+
+	res.TopArtists, err = TopArtists(db, params)
+	if err != nil {
+		return res, err
+	}
+	res.TopAlbums, err = TopAlbums(db, params)
+	if err != nil {
+		return res, err
+	}
+	res.TopTracks, err = TopTracks(db, params)
+	if err != nil {
+		return res, err
+	}
+
+	daily, err := DailyCounts(db, params.Start, params.End, tz)
+	if err != nil {
+		return res, err
+	}
+	for _, day := range daily {
+		if day.PlayCount > res.BusiestDay.PlayCount {
+			res.BusiestDay = day
+		}
+		if len(res.Monthly) == 0 || res.Monthly[len(res.Monthly)-1].Start.Month() != day.Start.Month() {
+			res.Monthly = append(res.Monthly, MonthReview{Start: day.Start})
+		}
+		res.Monthly[len(res.Monthly)-1].PlayCount += day.PlayCount
+	}
+	for _, s := range sessions {
+		res.Monthly[int(s.Start.Month())-1].Minutes += s.Minutes
+	}
+
+	dp := DefaultDiscoveryParams()
+	dp.Limit = yearReviewLimit
+	res.Discoveries, err = Discover(db, params, dp)
+	if err != nil {
+		return res, err
+	}
+
+	res.MostReplayed, err = mostReplayed(db, params)
+	return res, err
+}
+
+// mostReplayed finds the track with the most plays on a single
+// calendar day, preferring the earliest day on a tie
+func mostReplayed(db *sql.DB, params DateRangeParams) (*ReplayResult, error) {
+	query := `select min(a.id), min(a.artist_id), a.artist, a.title, ` + slotExpr + `, count(*)
+	from activity a
+	where a.uts >= ? and a.uts < ?
+	and not ` + isExcluded + `
+	group by a.artist, a.title, ` + slotExpr + `
+	order by 5;`
+
+	rows, err := db.Query(query, params.Start.Unix(), params.End.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type trackDay struct {
+		track trackKey
+		day   time.Time
+	}
+	counts := map[trackDay]*ReplayResult{}
+	var best *ReplayResult
+
+	for rows.Next() {
+		var r ReplayResult
+		var slot int64
+		err = rows.Scan(&r.ID, &r.ArtistID, &r.Artist, &r.Title, &slot, &r.PlayCount)
+		if err != nil {
+			return nil, err
+		}
+		r.Day = dayStart(slotTime(slot), params.TZ)
+
+		key := trackDay{trackKey{r.Artist, r.Title}, r.Day}
+		c, ok := counts[key]
+		if !ok {
+			c = &r
+			counts[key] = c
+		} else {
+			c.PlayCount += r.PlayCount
+		}
+		// rows come in time order, so an earlier day always got there first
+		if best == nil || c.PlayCount > best.PlayCount {
+			best = c
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	// like TrackResult, the id is the track's first play ever
+	err = db.QueryRow(`select min(id) from activity where artist = ? and title = ?`,
+		best.Artist, best.Title).Scan(&best.ID)
+	return best, err
+}
@@ -0,0 +1,73 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestYearReview(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	at := func(month time.Month, day, hour, min int) int64 {
+		return time.Date(2024, month, day, hour, min, 0, 0, time.UTC).Unix()
+	}
+	storePlays(t, db, []testPlay{
+		// the year before
+		{uts: time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC).Unix(), artist: "Low", title: "Words"},
+		{uts: time.Date(2023, time.June, 1, 12, 5, 0, 0, time.UTC).Unix(), artist: "Low", title: "Lazy"},
+		{uts: time.Date(2023, time.June, 8, 12, 0, 0, 0, time.UTC).Unix(), artist: "Low", title: "Words"},
+
+		{uts: at(time.January, 10, 20, 0), artist: "Low", title: "Words"},
+		{uts: at(time.January, 10, 20, 10), artist: "Low", title: "Sunflower"},
+		{uts: at(time.March, 5, 21, 0), artist: "Broadcast", title: "Echo's Answer"},
+		{uts: at(time.March, 5, 21, 5), artist: "Broadcast", title: "Echo's Answer"},
+		{uts: at(time.March, 5, 21, 10), artist: "Broadcast", title: "Echo's Answer"},
+		{uts: at(time.March, 5, 21, 15), artist: "Low", title: "Words"},
+		{uts: at(time.March, 20, 9, 0), artist: "Low", title: "Lazy"},
+	})
+
+	res, err := YearReview(db.SQL, 2024, time.UTC, DefaultSessionGap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Broadcast is the only artist that's new in 2024
+	totals := YearTotals{PlayCount: 7, Minutes: 25, UniqueArtists: 2, UniqueTracks: 4, NewArtists: 1}
+	if res.Totals != totals {
+		t.Errorf("totals are %+v, want %+v", res.Totals, totals)
+	}
+	previous := YearTotals{PlayCount: 3, Minutes: 5, UniqueArtists: 1, UniqueTracks: 2, NewArtists: 1}
+	if res.Previous != previous {
+		t.Errorf("previous year is %+v, want %+v", res.Previous, previous)
+	}
+
+	march5 := time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC)
+	if !res.BusiestDay.Start.Equal(march5) || res.BusiestDay.PlayCount != 4 {
+		t.Errorf("busiest day is %+v, want %v with 4 plays", res.BusiestDay, march5)
+	}
+
+	if len(res.Monthly) != 12 {
+		t.Fatalf("got %d months, want 12", len(res.Monthly))
+	}
+	months := map[time.Month]MonthReview{
+		time.January:  {PlayCount: 2, Minutes: 10},
+		time.February: {},
+		time.March:    {PlayCount: 5, Minutes: 15},
+	}
+	for i, got := range res.Monthly {
+		month := time.Month(i + 1)
+		want := months[month]
+		if !got.Start.Equal(time.Date(2024, month, 1, 0, 0, 0, 0, time.UTC)) ||
+			got.PlayCount != want.PlayCount || got.Minutes != want.Minutes {
+			t.Errorf("%s is %+v, want %d plays and %d minutes", month, got, want.PlayCount, want.Minutes)
+		}
+	}
+
+	if res.LongestSession == nil || res.LongestSession.Minutes != 15 {
+		t.Errorf("longest session is %+v", res.LongestSession)
+	}
+	if res.MostReplayed == nil || res.MostReplayed.Title != "Echo's Answer" || res.MostReplayed.PlayCount != 3 {
+		t.Errorf("most replayed is %+v", res.MostReplayed)
+	}
+}
@@ -0,0 +1,301 @@
+package query
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+// the rollup tables (see pkg/model/rollup.go) hold play counts per utc
+// day and per quarter hour. a date range in any timezone is answered
+// from the utc days it covers completely, plus the plays in the partial
+// days at either end counted straight from activity, so the results
+// are the same as querying activity alone. they only store artist names
+// and titles, so ids are looked up by name
+
+const rollupDayFormat = "2006-01-02"
+
+// rollupSplit divides a date range into the whole utc days inside it and
+// the partial days before and after them, as unix time ranges
+type rollupSplit struct {
+	firstDay, endDay   string // rollup day keys, endDay is exclusive
+	headStart, headEnd int64
+	tailStart, tailEnd int64
+}
+
+// splitRange splits a date range for the rollup queries. ok is false if
+// there's no whole utc day in it, in which case everything is in the head
+func splitRange(start, end time.Time) (split rollupSplit, ok bool) {
+	day := 24 * time.Hour
+	first := start.UTC().Truncate(day)
+	if first.Before(start) {
+		first = first.Add(day)
+	}
+	last := end.UTC().Truncate(day)
+
+	if !first.Before(last) {
+		return rollupSplit{headStart: start.Unix(), headEnd: end.Unix()}, false
+	}
+	return rollupSplit{
+		firstDay:  first.Format(rollupDayFormat),
+		endDay:    last.Format(rollupDayFormat),
+		headStart: start.Unix(),
+		headEnd:   first.Unix(),
+		tailStart: last.Unix(),
+		tailEnd:   end.Unix(),
+	}, true
+}
+
+// args are the query arguments for the day range followed by the
+// head and tail ranges
+func (s rollupSplit) args() []interface{} {
+	return []interface{}{s.firstDay, s.endDay, s.headStart, s.headEnd, s.tailStart, s.tailEnd}
+}
+
+// coversRollupDay reports whether a date range covers a whole utc
+// day, which is when the rollups are worth using
+func coversRollupDay(start, end time.Time) bool {
+	_, ok := splitRange(start, end)
+	return ok
+}
+
+// slotAligned reports whether a date range can be answered
+// from the quarter hour rollup
+func slotAligned(start, end time.Time) bool {
+	return start.Unix()%m.QuarterHour == 0 && end.Unix()%m.QuarterHour == 0
+}
+
+// rollupEdges is the condition for activity rows (aliased as "a") in the
+// head and tail of a rollupSplit
+const rollupEdges = `((a.uts >= ? and a.uts < ?) or (a.uts >= ? and a.uts < ?))
+	and not ` + isExcluded
+
+func topTracksRollup(db *sql.DB, params DateRangeParams) ([]TrackResult, error) {
+	split, _ := splitRange(params.Start, params.End)
+
+	query := `select (select min(id) from activity where artist = r.artist and title = r.title),
+	(select min(id) from artist where name = r.artist),
+	r.artist, r.title, sum(r.plays) as plays, group_concat(distinct i.url)
+	from (select artist, title, image_id, plays from rollup_track_day
+		where day >= ? and day < ?
+		union all
+		select a.artist, a.title, coalesce(a.image_id, 0), 1 from activity a
+		where ` + rollupEdges + `) r
+	left join image i on r.image_id = i.id
+	group by r.artist, r.title
+	order by plays desc, r.artist, r.title limit ?;`
+
+	return scanTopTracks(db.Query(query, append(split.args(), params.Limit)...))
+}
+
+func topArtistsRollup(db *sql.DB, params DateRangeParams) ([]ArtistResult, error) {
+	split, _ := splitRange(params.Start, params.End)
+
+	query := `select (select min(id) from artist where name = r.artist),
+	r.artist, sum(r.plays) as plays, group_concat(distinct i.url)
+	from (select artist, image_id, plays from rollup_artist_day
+		where day >= ? and day < ?
+		union all
+		select a.artist, coalesce(a.image_id, 0), 1 from activity a
+		where ` + rollupEdges + `) r
+	left join image i on r.image_id = i.id
+	group by r.artist
+	order by plays desc, r.artist limit ?;`
+
+	return scanTopArtists(db.Query(query, append(split.args(), params.Limit)...))
+}
+
+func topNewArtistsRollup(db *sql.DB, params DateRangeParams, minPlays int) ([]ArtistResult, error) {
+	// the candidates are artists first played on one of the utc days
+	// the range touches, then each one's exact first play is looked up
+	// to check it's inside the range, along with their plays before the
+	// end of it. image_id 0 stands in for null in the rollups
+	query := `select r.artist_id, r.artist, r.plays, r.first, i.url from
+	(select (select min(id) from artist where name = d.artist) as artist_id,
+		d.artist, d.img_id,
+		(select min(a.uts) from activity a
+			where a.artist = d.artist and not ` + isExcluded + `) as first,
+		(select count(*) from activity a
+			where a.artist = d.artist and a.uts < ? and not ` + isExcluded + `) as plays
+	from (select artist, min(nullif(image_id, 0)) as img_id
+		from rollup_artist_day
+		group by artist
+		having min(day) >= ?
+		and min(day) <= ?) d) r
+	left join image i on i.id = r.img_id
+	where r.first >= ? and r.first < ?
+	and r.plays >= ?
+	order by r.plays desc, r.artist;`
+
+	lastDay := params.End.Add(-time.Second)
+	return scanTopNewArtists(db.Query(query,
+		params.End.Unix(),
+		params.Start.UTC().Format(rollupDayFormat),
+		lastDay.UTC().Format(rollupDayFormat),
+		params.Start.Unix(),
+		params.End.Unix(),
+		minPlays))
+}
+
+// slotCountsRollup finds (quarter hour slot, play count)
+// rows over a date range
+func slotCountsRollup(db *sql.DB, start, end time.Time) (*sql.Rows, error) {
+	query := `select slot, plays
+	from rollup_quarter_hour
+	where slot >= ? and slot < ?
+	order by 1;`
+
+	return db.Query(query, start.Unix()/m.QuarterHour, end.Unix()/m.QuarterHour)
+}
+
+// VerifyRollups checks that the rollup tables agree with the activity
+// table for every utc calendar month and year between start and end,
+// returning a description of each mismatch. An empty result means the
+// rollups can be trusted
+func VerifyRollups(db *sql.DB, start, end time.Time) ([]string, error) {
+	var problems []string
+
+	var windows []DateRangeParams
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for month.Before(end) {
+		windows = append(windows, DateRangeParams{
+			Mode:  "month",
+			Start: month,
+			End:   month.AddDate(0, 1, 0),
+			Limit: 50,
+			TZ:    time.UTC,
+		})
+		month = month.AddDate(0, 1, 0)
+	}
+	for y := start.Year(); y <= end.Year(); y++ {
+		yearStart := time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+		windows = append(windows, DateRangeParams{
+			Mode:  "year",
+			Start: yearStart,
+			End:   yearStart.AddDate(1, 0, 0),
+			Limit: 50,
+			TZ:    time.UTC,
+		})
+	}
+
+	for _, w := range windows {
+		label := fmt.Sprintf("%s %s", w.Mode, w.Start.Format(rollupDayFormat))
+
+		rawTracks, err := topTracksActivity(db, w)
+		if err != nil {
+			return problems, err
+		}
+		rollupTracks, err := topTracksRollup(db, w)
+		if err != nil {
+			return problems, err
+		}
+		if !sameTracks(rawTracks, rollupTracks) {
+			problems = append(problems, label+": top tracks differ")
+		}
+
+		rawArtists, err := topArtistsActivity(db, w)
+		if err != nil {
+			return problems, err
+		}
+		rollupArtists, err := topArtistsRollup(db, w)
+		if err != nil {
+			return problems, err
+		}
+		if !sameArtists(rawArtists, rollupArtists) {
+			problems = append(problems, label+": top artists differ")
+		}
+
+		rawNew, err := topNewArtistsActivity(db, w, DefaultDiscoveryParams().MinArtistPlays)
+		if err != nil {
+			return problems, err
+		}
+		rollupNew, err := topNewArtistsRollup(db, w, DefaultDiscoveryParams().MinArtistPlays)
+		if err != nil {
+			return problems, err
+		}
+		if !sameArtists(rawNew, rollupNew) {
+			problems = append(problems, label+": new artists differ")
+		}
+
+		rawSlots, err := collectSlotCounts(slotCountsActivity(db, w.Start, w.End))
+		if err != nil {
+			return problems, err
+		}
+		rollupSlots, err := collectSlotCounts(slotCountsRollup(db, w.Start, w.End))
+		if err != nil {
+			return problems, err
+		}
+		if !reflect.DeepEqual(rawSlots, rollupSlots) {
+			problems = append(problems, label+": quarter hour counts differ")
+		}
+	}
+
+	return problems, nil
+}
+
+func collectSlotCounts(rows *sql.Rows, err error) (map[int64]int, error) {
+	counts := map[int64]int{}
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slot int64
+		var count int
+		err = rows.Scan(&slot, &count)
+		if err != nil {
+			return counts, err
+		}
+		counts[slot] = count
+	}
+	return counts, rows.Err()
+}
+
+// group_concat(distinct) doesn't guarantee an order, so image
+// lists are compared as sets
+func sameImages(a, b []string) bool {
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+func sameTracks(a, b []TrackResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Artist != b[i].Artist || a[i].Title != b[i].Title ||
+			a[i].PlayCount != b[i].PlayCount || !sameImages(a[i].ImageURLs, b[i].ImageURLs) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameArtists(a, b []ArtistResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].PlayCount != b[i].PlayCount ||
+			!sameImages(a[i].ImageURLs, b[i].ImageURLs) ||
+			!sameTime(a[i].FirstPlayed, b[i].FirstPlayed) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,303 @@
+package query
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+// fixture timezones, including ones whose offsets
+// aren't a whole number of hours
+var testZones = []string{
+	"UTC",
+	"America/New_York",
+	"Asia/Kolkata",
+	"Asia/Kathmandu",
+	"America/St_Johns",
+}
+
+func loadZone(t *testing.T, name string) *time.Location {
+	tz, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tz
+}
+
+// testPlay is a single scrobble in a fixture
+type testPlay struct {
+	uts                  int64
+	artist, album, title string
+	image                string
+}
+
+// trackInfo converts a play to what StoreActivity expects. TrackInfo has
+// anonymous nested structs, so it's easiest to build from xml
+func (p testPlay) trackInfo(t *testing.T) m.TrackInfo {
+	var ti m.TrackInfo
+	doc := fmt.Sprintf(`<track><artist>%s</artist><name>%s</name><album>%s</album>`+
+		`<image size="large">%s</image><date uts="%d"></date></track>`,
+		p.artist, p.title, p.album, p.image, p.uts)
+	err := xml.Unmarshal([]byte(doc), &ti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ti
+}
+
+// newTestDB creates a database from the initial schema and opens it,
+// which runs all of the migrations. The returned func removes it
+func newTestDB(t *testing.T) (*m.Database, func()) {
+	dir, err := ioutil.TempDir("", "localfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	schema, err := ioutil.ReadFile("../../scripts/schema.sql")
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.db")
+	raw, err := sql.Open("sqlite3", path)
+	if err == nil {
+		_, err = raw.Exec(string(schema))
+		raw.Close()
+	}
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	db, err := m.Open("sqlite://" + path)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.SQL.Close()
+		cleanup()
+	}
+}
+
+// storePlays adds plays to a test database through StoreActivity
+func storePlays(t *testing.T, db *m.Database, plays []testPlay) {
+	tracks := make([]m.TrackInfo, len(plays))
+	for i, p := range plays {
+		tracks[i] = p.trackInfo(t)
+	}
+	err := db.StoreActivity(tracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureStart and fixtureEnd bound the rollup fixture, a week
+// that includes the start of daylight saving time in the US
+var (
+	fixtureStart = time.Date(2024, time.March, 7, 0, 0, 0, 0, time.UTC)
+	fixtureEnd   = time.Date(2024, time.March, 14, 0, 0, 0, 0, time.UTC)
+)
+
+// rollupFixture is a week of plays with some on every side of utc and
+// local midnights, some that are excluded and some artists that are only
+// played from part way through
+func rollupFixture(t *testing.T) []testPlay {
+	var plays []testPlay
+
+	artists := []string{"Radiohead", "Low", "Rain Sounds", "Broadcast", "Stereolab"}
+	titles := []string{"One", "Two", "A podcast episode"}
+	images := []string{"http://img/1.jpg", "http://img/2.jpg", "", "http://img/3.jpg"}
+
+	i := 0
+	for uts := fixtureStart.Unix(); uts < fixtureEnd.Unix(); uts += 23*60 + 7 {
+		plays = append(plays, testPlay{
+			uts:    uts,
+			artist: artists[i%len(artists)],
+			album:  "Album " + artists[i%len(artists)],
+			title:  titles[i%len(titles)],
+			image:  images[i%len(images)],
+		})
+		i++
+	}
+
+	// a second either side of every midnight
+	for _, name := range testZones {
+		tz := loadZone(t, name)
+		day := fixtureStart.In(tz)
+		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, tz)
+		for ; day.Before(fixtureEnd); day = day.AddDate(0, 0, 1) {
+			for _, uts := range []int64{day.Unix() - 1, day.Unix()} {
+				plays = append(plays, testPlay{
+					uts:    uts,
+					artist: "Midnight " + name,
+					album:  "Edges",
+					title:  fmt.Sprintf("Edge %d", uts%3),
+					image:  images[uts%int64(len(images))],
+				})
+			}
+		}
+	}
+
+	// new artists first played at different times in the week
+	for d := 0; d < 6; d++ {
+		first := fixtureStart.AddDate(0, 0, d).Add(time.Duration(d*4+1)*time.Hour + 20*time.Minute)
+		for n := 0; n < d+2; n++ {
+			plays = append(plays, testPlay{
+				uts:    first.Add(time.Duration(n) * 7 * time.Hour).Unix(),
+				artist: fmt.Sprintf("Debut %d", d),
+				album:  "First Album",
+				title:  fmt.Sprintf("Song %d", n%2),
+				image:  images[n%len(images)],
+			})
+		}
+	}
+
+	// stored in time order, like an update
+	for i := 1; i < len(plays); i++ {
+		for j := i; j > 0 && plays[j].uts < plays[j-1].uts; j-- {
+			plays[j], plays[j-1] = plays[j-1], plays[j]
+		}
+	}
+	return plays
+}
+
+// fixtureRanges are the date ranges checked in tz
+func fixtureRanges(t *testing.T, tz *time.Location) []DateRangeParams {
+	var ranges []DateRangeParams
+	add := func(p DateRangeParams, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Limit = 100 // everything, not just the top of the chart
+		ranges = append(ranges, p)
+	}
+
+	now := time.Date(2024, time.March, 13, 12, 0, 0, 0, time.UTC)
+	for offset := 0; offset < 8; offset++ {
+		add(NewDateRange("day", offset, now, tz, time.Sunday))
+	}
+	for _, mode := range []string{"week", "calweek", "isoweek", "month", "all"} {
+		add(NewDateRange(mode, 0, now, tz, time.Sunday))
+	}
+	add(CustomDateRange("2024-03-08", "2024-03-11", tz))
+	return ranges
+}
+
+func TestRollupsMatchActivity(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// half the plays are stored before the exclusions are added,
+	// which rebuilds the rollups, and half after
+	plays := rollupFixture(t)
+	storePlays(t, db, plays[:len(plays)/2])
+	if _, err := db.AddExclusion("artist", "rain sounds"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddExclusion("title", "%podcast%"); err != nil {
+		t.Fatal(err)
+	}
+	storePlays(t, db, plays[len(plays)/2:])
+
+	for _, name := range testZones {
+		tz := loadZone(t, name)
+		for _, params := range fixtureRanges(t, tz) {
+			label := fmt.Sprintf("%s %s %s", name, params.Mode, params.Start.Format(time.RFC3339))
+
+			rawArtists, err := topArtistsActivity(db.SQL, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rollupArtists, err := topArtistsRollup(db.SQL, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rawArtists) == 0 {
+				t.Errorf("%s: no artists in fixture range", label)
+			}
+			if !sameArtists(rawArtists, rollupArtists) {
+				t.Errorf("%s: top artists differ\nactivity: %v\nrollup:   %v", label, rawArtists, rollupArtists)
+			}
+
+			rawTracks, err := topTracksActivity(db.SQL, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rollupTracks, err := topTracksRollup(db.SQL, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameTracks(rawTracks, rollupTracks) {
+				t.Errorf("%s: top tracks differ\nactivity: %v\nrollup:   %v", label, rawTracks, rollupTracks)
+			}
+
+			rawNew, err := topNewArtistsActivity(db.SQL, params, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rollupNew, err := topNewArtistsRollup(db.SQL, params, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameArtists(rawNew, rollupNew) {
+				t.Errorf("%s: new artists differ\nactivity: %v\nrollup:   %v", label, rawNew, rollupNew)
+			}
+
+			rawSlots, err := collectSlotCounts(slotCountsActivity(db.SQL, params.Start, params.End))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rollupSlots, err := collectSlotCounts(slotCountsRollup(db.SQL, params.Start, params.End))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rawSlots) != len(rollupSlots) {
+				t.Errorf("%s: %d quarter hours from activity, %d from rollup", label, len(rawSlots), len(rollupSlots))
+			}
+			for slot, count := range rawSlots {
+				if rollupSlots[slot] != count {
+					t.Errorf("%s: quarter hour %d has %d plays in activity, %d in rollup",
+						label, slot, count, rollupSlots[slot])
+				}
+			}
+		}
+	}
+}
+
+func TestListeningClockLocalHours(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	plays := rollupFixture(t)
+	storePlays(t, db, plays)
+
+	for _, name := range testZones {
+		tz := loadZone(t, name)
+		for _, params := range fixtureRanges(t, tz) {
+			var want [24]int
+			for _, p := range plays {
+				if p.uts >= params.Start.Unix() && p.uts < params.End.Unix() {
+					want[time.Unix(p.uts, 0).In(tz).Hour()]++
+				}
+			}
+
+			got, err := listeningClockHelper(db.SQL, params.Start, params.End, tz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("%s %s %s: clock is %v, want %v", name, params.Mode,
+					params.Start.Format(time.RFC3339), got, want)
+			}
+		}
+	}
+}
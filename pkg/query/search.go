@@ -0,0 +1,189 @@
+package query
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+// SearchArtistResult is an artist whose name matched a search
+type SearchArtistResult struct {
+	Artist    string    `json:"artist"`
+	PlayCount int       `json:"count"`
+	FirstPlay time.Time `json:"firstPlay"`
+	LastPlay  time.Time `json:"lastPlay"`
+}
+
+// SearchAlbumResult is an album whose name matched a search
+type SearchAlbumResult struct {
+	Artist    string    `json:"artist"`
+	Album     string    `json:"album"`
+	PlayCount int       `json:"count"`
+	FirstPlay time.Time `json:"firstPlay"`
+	LastPlay  time.Time `json:"lastPlay"`
+	ImageURL  string    `json:"url"`
+}
+
+// SearchTrackResult is a track whose title matched a search
+type SearchTrackResult struct {
+	Artist    string    `json:"artist"`
+	Title     string    `json:"title"`
+	PlayCount int       `json:"count"`
+	FirstPlay time.Time `json:"firstPlay"`
+	LastPlay  time.Time `json:"lastPlay"`
+	ImageURL  string    `json:"url"`
+}
+
+// SearchResults holds the matches for a search, grouped by type
+type SearchResults struct {
+	Query   string               `json:"query"`
+	Artists []SearchArtistResult `json:"artists"`
+	Albums  []SearchAlbumResult  `json:"albums"`
+	Tracks  []SearchTrackResult  `json:"tracks"`
+}
+
+// searchExpression turns free text typed by a user into an fts5 match
+// expression restricted to a single column. Every word is quoted so
+// punctuation can't be misread as query syntax, and is treated as a
+// prefix so results show up while the user is still typing
+func searchExpression(column, text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		word = strings.ReplaceAll(word, `"`, `""`)
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return column + " : (" + strings.Join(terms, " AND ") + ")"
+}
+
+// Search finds artists, albums and tracks in the listening history that
+// match some text, with play counts and the first/last time each was
+// played. At most limit results of each type are returned.
+// m.ErrSearchUnavailable is returned if this binary was built without
+// the search index
+func Search(db *sql.DB, text string, limit int) (SearchResults, error) {
+	res := SearchResults{
+		Query:   text,
+		Artists: []SearchArtistResult{},
+		Albums:  []SearchAlbumResult{},
+		Tracks:  []SearchTrackResult{},
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return res, errors.New("invalid parameter: search text can't be empty")
+	}
+	if !m.SearchAvailable() {
+		return res, m.ErrSearchUnavailable
+	}
+
+	// artists
+	query := `select a.artist, count(*) as plays, min(a.uts), max(a.uts)
+	from activity_fts
+	join activity a on a.id = activity_fts.rowid
+	where activity_fts match ?
+	and not ` + isExcluded + `
+	group by a.artist
+	order by plays desc limit ?;`
+
+	rows, err := db.Query(query, searchExpression("artist", text), limit)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var first, last int64
+		r := SearchArtistResult{}
+		err = rows.Scan(&r.Artist, &r.PlayCount, &first, &last)
+		if err != nil {
+			return res, err
+		}
+		r.FirstPlay = time.Unix(first, 0).UTC()
+		r.LastPlay = time.Unix(last, 0).UTC()
+		res.Artists = append(res.Artists, r)
+	}
+	rows.Close()
+
+	// albums
+	// min(i.url) is used just to choose a single image
+	query = `select a.artist, a.album, count(*) as plays, min(a.uts), max(a.uts), min(i.url)
+	from activity_fts
+	join activity a on a.id = activity_fts.rowid
+	left join image i on a.image_id = i.id
+	where activity_fts match ?
+	and not ` + isExcluded + `
+	group by a.artist, a.album
+	order by plays desc limit ?;`
+
+	rows, err = db.Query(query, searchExpression("album", text), limit)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var first, last int64
+		var imageURL sql.NullString
+		r := SearchAlbumResult{}
+		err = rows.Scan(&r.Artist, &r.Album, &r.PlayCount, &first, &last, &imageURL)
+		if err != nil {
+			return res, err
+		}
+		r.FirstPlay = time.Unix(first, 0).UTC()
+		r.LastPlay = time.Unix(last, 0).UTC()
+		r.ImageURL = imageURL.String
+		res.Albums = append(res.Albums, r)
+	}
+	rows.Close()
+
+	// tracks
+	query = `select a.artist, a.title, count(*) as plays, min(a.uts), max(a.uts), min(i.url)
+	from activity_fts
+	join activity a on a.id = activity_fts.rowid
+	left join image i on a.image_id = i.id
+	where activity_fts match ?
+	and not ` + isExcluded + `
+	group by a.artist, a.title
+	order by plays desc limit ?;`
+
+	rows, err = db.Query(query, searchExpression("title", text), limit)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var first, last int64
+		var imageURL sql.NullString
+		r := SearchTrackResult{}
+		err = rows.Scan(&r.Artist, &r.Title, &r.PlayCount, &first, &last, &imageURL)
+		if err != nil {
+			return res, err
+		}
+		r.FirstPlay = time.Unix(first, 0).UTC()
+		r.LastPlay = time.Unix(last, 0).UTC()
+		r.ImageURL = imageURL.String
+		res.Tracks = append(res.Tracks, r)
+	}
+
+	return res, nil
+}
+
+// InTimezone converts all of the play times in a set of results
+// to a specific timezone, for display
+func (sr *SearchResults) InTimezone(tz *time.Location) {
+	for i := range sr.Artists {
+		sr.Artists[i].FirstPlay = sr.Artists[i].FirstPlay.In(tz)
+		sr.Artists[i].LastPlay = sr.Artists[i].LastPlay.In(tz)
+	}
+	for i := range sr.Albums {
+		sr.Albums[i].FirstPlay = sr.Albums[i].FirstPlay.In(tz)
+		sr.Albums[i].LastPlay = sr.Albums[i].LastPlay.In(tz)
+	}
+	for i := range sr.Tracks {
+		sr.Tracks[i].FirstPlay = sr.Tracks[i].FirstPlay.In(tz)
+		sr.Tracks[i].LastPlay = sr.Tracks[i].LastPlay.In(tz)
+	}
+}
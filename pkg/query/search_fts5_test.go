@@ -0,0 +1,122 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package query
+
+import (
+	"testing"
+	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+func searchFixture(t *testing.T, db *m.Database) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix()
+	storePlays(t, db, []testPlay{
+		{uts: start, artist: "Radiohead", album: "OK Computer", title: "Paranoid Android"},
+		{uts: start + 300, artist: "Radiohead", album: "OK Computer", title: "Lucky"},
+		{uts: start + 600, artist: "Low", album: "Things We Lost in the Fire", title: "Sunflower"},
+	})
+}
+
+func TestSearchPrefix(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	searchFixture(t, db)
+
+	res, err := Search(db.SQL, "radio", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Artists) != 1 || res.Artists[0].Artist != "Radiohead" || res.Artists[0].PlayCount != 2 {
+		t.Errorf("artists matching radio are %+v", res.Artists)
+	}
+
+	// every word is a prefix, and all of them have to match
+	res, err = Search(db.SQL, "ok comp", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Albums) != 1 || res.Albums[0].Album != "OK Computer" || res.Albums[0].PlayCount != 2 {
+		t.Errorf("albums matching ok comp are %+v", res.Albums)
+	}
+	res, err = Search(db.SQL, "ok fire", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Albums) != 0 {
+		t.Errorf("albums matching ok fire are %+v", res.Albums)
+	}
+
+	res, err = Search(db.SQL, "sun", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Tracks) != 1 || res.Tracks[0].Title != "Sunflower" || len(res.Artists) != 0 {
+		t.Errorf("sun matches %+v", res)
+	}
+
+	// query syntax is searched for like any other text
+	if _, err = Search(db.SQL, `"lucky" OR`, 10); err != nil {
+		t.Errorf("searching for query syntax: %v", err)
+	}
+}
+
+func TestSearchIndexCatchesUp(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	searchFixture(t, db)
+
+	lastID := func(db *m.Database) (indexed, newest int64) {
+		err := db.SQL.QueryRow(`select (select last_id from search_index),
+			(select max(id) from activity)`).Scan(&indexed, &newest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return indexed, newest
+	}
+	if indexed, newest := lastID(db); indexed != newest {
+		t.Errorf("indexed up to %d of %d after storing plays", indexed, newest)
+	}
+
+	// a binary without fts5 stores activity without indexing it
+	uts := time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC).Unix()
+	_, err := db.SQL.Exec(`insert into activity(uts, dt, title, artist, album)
+		values (?, datetime(?, 'unixepoch'), 'Echo''s Answer', 'Broadcast', 'Tender Buttons')`, uts, uts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Search(db.SQL, "broad", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Artists) != 0 {
+		t.Fatalf("unindexed play was found: %+v", res.Artists)
+	}
+
+	// and the next binary with fts5 to open the database catches up
+	reopened, err := m.Open("sqlite://" + db.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.SQL.Close()
+	if indexed, newest := lastID(reopened); indexed != newest {
+		t.Errorf("indexed up to %d of %d after reopening", indexed, newest)
+	}
+	res, err = Search(reopened.SQL, "broad", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Artists) != 1 || res.Artists[0].Artist != "Broadcast" {
+		t.Errorf("artists matching broad are %+v", res.Artists)
+	}
+
+	// rows that were already indexed aren't added twice
+	res, err = Search(reopened.SQL, "radio", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Artists) != 1 || res.Artists[0].PlayCount != 2 {
+		t.Errorf("artists matching radio are %+v", res.Artists)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !sqlite_fts5
+// +build !sqlite_fts5
+
+package query
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+func TestSearchUnavailable(t *testing.T) {
+	// the database opens and stores plays without fts5
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	storePlays(t, db, []testPlay{
+		{uts: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Unix(), artist: "Low", title: "Words"},
+	})
+
+	if m.SearchAvailable() {
+		t.Error("search is available without fts5")
+	}
+	_, err := Search(db.SQL, "low", 10)
+	if !errors.Is(err, m.ErrSearchUnavailable) {
+		t.Errorf("searching without fts5 returned %v", err)
+	}
+
+	// nothing has been indexed for a binary with fts5 to skip
+	var indexed int64
+	err = db.SQL.QueryRow(`select last_id from search_index`).Scan(&indexed)
+	if err != nil || indexed != 0 {
+		t.Errorf("indexed up to %d, %v", indexed, err)
+	}
+}
@@ -0,0 +1,149 @@
+package query
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DefaultSessionGap is the longest break between two plays in the same
+// session, unless the user has chosen something else
+const DefaultSessionGap = 30 * time.Minute
+
+// sessions longer than this are cut off when looking for one
+const maxSessionSpan = 24 * time.Hour
+
+// Session is a run of plays without a long break between them. Scrobbles
+// only record when a track started, so the length of a session runs from
+// its first play to the start of its last one
+type Session struct {
+	Start            time.Time        `json:"start"`
+	End              time.Time        `json:"end"`
+	Minutes          int              `json:"minutes"`
+	PlayCount        int              `json:"count"`
+	DominantArtist   string           `json:"artist"` // artist with the most plays
+	DominantArtistID int64            `json:"artistId"`
+	FullAlbum        bool             `json:"fullAlbum"` // has an album listen
+	Plays            []ActivityResult `json:"plays,omitempty"`
+}
+
+// SessionStats summarizes the sessions in a date range
+type SessionStats struct {
+	Count        int      `json:"count"`
+	TotalMinutes int      `json:"totalMinutes"`
+	AvgMinutes   float64  `json:"avgMinutes"`
+	AvgPlays     float64  `json:"avgPlays"`
+	FullAlbums   int      `json:"fullAlbums"`
+	Longest      *Session `json:"longest"`
+}
+
+// newSession fills in the details of a session from its plays,
+// which must be in time order
+func newSession(plays []ActivityResult) Session {
+	s := Session{
+		Start:     plays[0].Time,
+		End:       plays[len(plays)-1].Time,
+		PlayCount: len(plays),
+		Plays:     plays,
+	}
+	s.Minutes = int(s.End.Sub(s.Start).Minutes())
+
+	// ties go to whoever got to that count first
+	counts := map[string]int{}
+	for _, p := range plays {
+		counts[p.Artist]++
+		if counts[p.Artist] > counts[s.DominantArtist] {
+			s.DominantArtist = p.Artist
+			s.DominantArtistID = p.ArtistID
+		}
+	}
+
+	s.FullAlbum = len(albumListens(plays)) > 0
+	return s
+}
+
+// sessionize splits plays in time order into sessions wherever
+// there's a break longer than gap
+func sessionize(plays []ActivityResult, gap time.Duration) []Session {
+	var sessions []Session
+	first := 0
+	for i := 1; i <= len(plays); i++ {
+		if i == len(plays) || plays[i].Time.Sub(plays[i-1].Time) > gap {
+			sessions = append(sessions, newSession(plays[first:i]))
+			first = i
+		}
+	}
+	return sessions
+}
+
+// sessionAround finds the listening session containing a play
+func sessionAround(db *sql.DB, play ActivityResult, tz *time.Location, gap time.Duration) (Session, error) {
+	session := Session{Start: play.Time, End: play.Time, Plays: []ActivityResult{}}
+
+	start := play.Time.Add(-maxSessionSpan).Unix()
+	end := play.Time.Add(maxSessionSpan).Unix()
+	nearby, err := activityPlays(db, tz, "a.uts >= ? and a.uts <= ?", start, end)
+	if err != nil {
+		return session, err
+	}
+
+	for _, s := range sessionize(nearby, gap) {
+		for _, p := range s.Plays {
+			if p.ID == play.ID {
+				return s, nil
+			}
+		}
+	}
+
+	// the play itself is excluded
+	return session, nil
+}
+
+// Sessions finds the listening sessions that start within a date range,
+// newest first, splitting plays wherever there's a break longer than gap.
+// The plays in each session aren't included
+func Sessions(db *sql.DB, params DateRangeParams, gap time.Duration) ([]Session, error) {
+	sessions := []Session{}
+
+	// sessions at either end of the range can start
+	// before it or finish after it
+	start := params.Start.Add(-maxSessionSpan).Unix()
+	end := params.End.Add(maxSessionSpan).Unix()
+	plays, err := activityPlays(db, params.TZ, "a.uts >= ? and a.uts < ?", start, end)
+	if err != nil {
+		return sessions, err
+	}
+
+	all := sessionize(plays, gap)
+	for i := len(all) - 1; i >= 0; i-- {
+		s := all[i]
+		if s.Start.Before(params.Start) || !s.Start.Before(params.End) {
+			continue
+		}
+		s.Plays = nil
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// SummarizeSessions calculates stats for a list of sessions
+func SummarizeSessions(sessions []Session) SessionStats {
+	stats := SessionStats{Count: len(sessions)}
+	if len(sessions) == 0 {
+		return stats
+	}
+
+	totalPlays := 0
+	for i, s := range sessions {
+		stats.TotalMinutes += s.Minutes
+		totalPlays += s.PlayCount
+		if s.FullAlbum {
+			stats.FullAlbums++
+		}
+		if stats.Longest == nil || s.Minutes > stats.Longest.Minutes {
+			stats.Longest = &sessions[i]
+		}
+	}
+	stats.AvgMinutes = float64(stats.TotalMinutes) / float64(len(sessions))
+	stats.AvgPlays = float64(totalPlays) / float64(len(sessions))
+	return stats
+}
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSessionize(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 20, 0, 0, 0, time.UTC)
+	var plays []ActivityResult
+	at := start
+	play := func(after time.Duration, artist, album, title string) {
+		at = at.Add(after)
+		plays = append(plays, ActivityResult{
+			ID:     int64(len(plays) + 1),
+			Artist: artist,
+			Album:  album,
+			Title:  title,
+			Time:   at,
+		})
+	}
+
+	// a break of exactly the gap doesn't end a session
+	play(0, "Low", "Things We Lost in the Fire", "Sunflower")
+	for i := 0; i < AlbumListenTracks; i++ {
+		after := 4 * time.Minute
+		if i == 0 {
+			after = DefaultSessionGap
+		}
+		play(after, "Broadcast", "Tender Buttons", fmt.Sprintf("Track %d", i))
+	}
+
+	// but a second longer does. The tracks are from the same album,
+	// but too few of them for a full album
+	play(DefaultSessionGap+time.Second, "Low", "Things We Lost in the Fire", "Sunflower")
+	play(3*time.Minute, "Stereolab", "Dots and Loops", "Brakhage")
+	play(3*time.Minute, "Low", "Things We Lost in the Fire", "Whitetail")
+
+	// Low gets to two plays first
+	play(time.Hour, "Stereolab", "Dots and Loops", "Brakhage")
+	play(3*time.Minute, "Low", "Things We Lost in the Fire", "Sunflower")
+	play(3*time.Minute, "Low", "Things We Lost in the Fire", "Whitetail")
+	play(3*time.Minute, "Stereolab", "Dots and Loops", "Miss Modular")
+
+	want := []struct {
+		first, count, minutes int
+		artist                string
+		fullAlbum             bool
+	}{
+		{0, 6, 46, "Broadcast", true},
+		{6, 3, 6, "Low", false},
+		{9, 4, 9, "Low", false},
+	}
+
+	sessions := sessionize(plays, DefaultSessionGap)
+	if len(sessions) != len(want) {
+		t.Fatalf("got %d sessions, want %d", len(sessions), len(want))
+	}
+	for i, w := range want {
+		s := sessions[i]
+		last := plays[w.first+w.count-1]
+		if !s.Start.Equal(plays[w.first].Time) || !s.End.Equal(last.Time) ||
+			s.PlayCount != w.count || len(s.Plays) != w.count || s.Minutes != w.minutes {
+			t.Errorf("session %d is %v to %v with %d plays and %d minutes, want %v to %v with %d and %d",
+				i, s.Start, s.End, s.PlayCount, s.Minutes, plays[w.first].Time, last.Time, w.count, w.minutes)
+		}
+		if s.DominantArtist != w.artist || s.FullAlbum != w.fullAlbum {
+			t.Errorf("session %d is mostly %s, full album %v, want %s, %v",
+				i, s.DominantArtist, s.FullAlbum, w.artist, w.fullAlbum)
+		}
+	}
+
+	if got := sessionize(nil, DefaultSessionGap); len(got) != 0 {
+		t.Errorf("no plays make %d sessions", len(got))
+	}
+}
@@ -0,0 +1,209 @@
+package query
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// taste similarity compares periods by what was listened to in them.
+// Each period is a vector of plays per artist, and two periods are as
+// similar as the cosine of the angle between their vectors: 1 for the
+// same mix of artists and 0 for no artists in common
+
+// number of artists that explain why two periods are similar
+const sharedArtistLimit = 3
+
+// artistVector is the number of plays of each artist in a period
+type artistVector map[string]int
+
+// SimilarPeriod is a period compared with another one
+type SimilarPeriod struct {
+	Start         time.Time `json:"start"`
+	Similarity    float64   `json:"similarity"`
+	PlayCount     int       `json:"count"`
+	SharedArtists []string  `json:"sharedArtists"` // the most in common, first
+}
+
+// SimilarityMatrix compares every year with every other year.
+// Similarity[i][j] compares Years[i] and Years[j]
+type SimilarityMatrix struct {
+	Years      []int       `json:"years"`
+	Similarity [][]float64 `json:"similarity"`
+}
+
+// MonthlyArtists is the number of plays of each artist in every month
+// in a timezone, from ArtistsByMonth. Years are summed from months, so
+// both comparisons come from one scan
+type MonthlyArtists struct {
+	tz     *time.Location
+	months map[time.Time]artistVector
+}
+
+// ArtistsByMonth counts plays per artist in each month in tz that has
+// any plays. Plays are counted per quarter hour in sql and only bucketed
+// into months here, so the result is right in any timezone without
+// scanning every play in go
+func ArtistsByMonth(db *sql.DB, tz *time.Location) (MonthlyArtists, error) {
+	res := MonthlyArtists{
+		tz:     tz,
+		months: map[time.Time]artistVector{},
+	}
+
+	query := `select a.artist, ` + slotExpr + `, count(*)
+	from activity a
+	where not ` + isExcluded + `
+	group by 1, 2;`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var slot int64
+		var count int
+		err = rows.Scan(&name, &slot, &count)
+		if err != nil {
+			return res, err
+		}
+		p := periodStart(slotTime(slot).In(tz), "month", time.Sunday)
+		if res.months[p] == nil {
+			res.months[p] = artistVector{}
+		}
+		res.months[p][name] += count
+	}
+	return res, rows.Err()
+}
+
+// years sums the months into calendar years
+func (m MonthlyArtists) years() map[time.Time]artistVector {
+	years := map[time.Time]artistVector{}
+	for start, v := range m.months {
+		p := periodStart(start, "year", time.Sunday)
+		if years[p] == nil {
+			years[p] = artistVector{}
+		}
+		for name, count := range v {
+			years[p][name] += count
+		}
+	}
+	return years
+}
+
+// playCount is the total number of plays in a vector
+func (v artistVector) playCount() int {
+	total := 0
+	for _, count := range v {
+		total += count
+	}
+	return total
+}
+
+// cosineSimilarity compares two vectors, 0 if either is empty
+func cosineSimilarity(a, b artistVector) float64 {
+	var dot, normA, normB float64
+	for name, count := range a {
+		normA += float64(count * count)
+		dot += float64(count * b[name])
+	}
+	for _, count := range b {
+		normB += float64(count * count)
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// sharedArtists are the artists that contribute the most
+// to the similarity of two vectors
+func sharedArtists(a, b artistVector, limit int) []string {
+	shared := []string{}
+	for name := range a {
+		if b[name] > 0 {
+			shared = append(shared, name)
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		pi, pj := a[shared[i]]*b[shared[i]], a[shared[j]]*b[shared[j]]
+		if pi != pj {
+			return pi > pj
+		}
+		return shared[i] < shared[j]
+	})
+	if len(shared) > limit {
+		shared = shared[:limit]
+	}
+	return shared
+}
+
+// SimilarMonths finds the months before the one containing month
+// whose mix of artists is most like it, most similar first
+func SimilarMonths(months MonthlyArtists, month time.Time, limit int) []SimilarPeriod {
+	similar := []SimilarPeriod{}
+
+	target := periodStart(month.In(months.tz), "month", time.Sunday)
+	current := months.months[target]
+	if len(current) == 0 {
+		return similar
+	}
+
+	for start, v := range months.months {
+		if !start.Before(target) {
+			continue
+		}
+		similar = append(similar, SimilarPeriod{
+			Start:         start,
+			Similarity:    cosineSimilarity(current, v),
+			PlayCount:     v.playCount(),
+			SharedArtists: sharedArtists(current, v, sharedArtistLimit),
+		})
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Similarity != similar[j].Similarity {
+			return similar[i].Similarity > similar[j].Similarity
+		}
+		return similar[i].Start.After(similar[j].Start)
+	})
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar
+}
+
+// YearSimilarity compares every calendar year up to the one
+// containing now that has plays in it to every other one
+func YearSimilarity(months MonthlyArtists, now time.Time) SimilarityMatrix {
+	res := SimilarityMatrix{
+		Years:      []int{},
+		Similarity: [][]float64{},
+	}
+
+	end := periodStart(now.In(months.tz), "year", time.Sunday).AddDate(1, 0, 0)
+	vectors := months.years()
+
+	starts := make([]time.Time, 0, len(vectors))
+	for start := range vectors {
+		if start.Before(end) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+
+	for _, a := range starts {
+		res.Years = append(res.Years, a.Year())
+		row := make([]float64, len(starts))
+		for j, b := range starts {
+			row[j] = cosineSimilarity(vectors[a], vectors[b])
+		}
+		res.Similarity = append(res.Similarity, row)
+	}
+	return res
+}
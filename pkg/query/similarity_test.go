@@ -0,0 +1,44 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimilarityHalfHourZone(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// the last two plays are in the same utc hour of new year's eve,
+	// but the second is already 2024 in india
+	storePlays(t, db, []testPlay{
+		{uts: time.Date(2023, time.November, 10, 12, 0, 0, 0, time.UTC).Unix(), artist: "Low", title: "Words"},
+		{uts: time.Date(2023, time.December, 31, 18, 20, 0, 0, time.UTC).Unix(), artist: "Low", title: "Lazy"},
+		{uts: time.Date(2023, time.December, 31, 18, 40, 0, 0, time.UTC).Unix(), artist: "Broadcast", title: "Echo's Answer"},
+	})
+
+	kolkata := loadZone(t, "Asia/Kolkata")
+	months, err := ArtistsByMonth(db.SQL, kolkata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	similar := SimilarMonths(months, time.Date(2023, time.December, 15, 0, 0, 0, 0, kolkata), 10)
+	if len(similar) != 1 || !similar[0].Start.Equal(time.Date(2023, time.November, 1, 0, 0, 0, 0, kolkata)) ||
+		similar[0].Similarity != 1 {
+		t.Errorf("months like december 2023 are %+v", similar)
+	}
+
+	matrix := YearSimilarity(months, time.Date(2024, time.June, 1, 0, 0, 0, 0, kolkata))
+	if len(matrix.Years) != 2 || matrix.Years[0] != 2023 || matrix.Years[1] != 2024 {
+		t.Fatalf("years are %v", matrix.Years)
+	}
+	if matrix.Similarity[0][0] != 1 || matrix.Similarity[0][1] != 0 {
+		t.Errorf("similarity is %v", matrix.Similarity)
+	}
+
+	// years after now are left out
+	if matrix := YearSimilarity(months, time.Date(2023, time.June, 1, 0, 0, 0, 0, kolkata)); len(matrix.Years) != 1 {
+		t.Errorf("years up to 2023 are %v", matrix.Years)
+	}
+}
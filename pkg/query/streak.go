@@ -0,0 +1,196 @@
+package query
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// streaks and consistency are about calendar days in the listener's
+// timezone, built from per quarter hour counts like the listening clock
+
+// Streak is a run of consecutive days with at least one play.
+// End is the start of the last day
+type Streak struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Days  int       `json:"days"`
+}
+
+// ArtistStreak is the longest streak of days an artist was played
+type ArtistStreak struct {
+	ArtistID int64  `json:"artistId"`
+	Artist   string `json:"artist"`
+	Streak   Streak `json:"streak"`
+}
+
+// StreakStats are the listening streaks over all time. The current
+// streak is still going if there was a play today or yesterday,
+// otherwise it's empty
+type StreakStats struct {
+	Longest Streak         `json:"longest"`
+	Current Streak         `json:"current"`
+	Artists []ArtistStreak `json:"artists"` // longest first
+}
+
+// ConsistencyResult is how many days of a period had any plays. Days
+// only counts days up to today, and nothing before the first play
+type ConsistencyResult struct {
+	ActiveDays int     `json:"activeDays"`
+	Days       int     `json:"days"`
+	Score      float64 `json:"score"` // fraction of days that were active
+}
+
+// dayStart truncates a time to midnight in tz
+func dayStart(t time.Time, tz *time.Location) time.Time {
+	t = t.In(tz)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, tz)
+}
+
+// streakRuns splits a set of days into runs of consecutive days, in
+// time order
+func streakRuns(days map[time.Time]bool) []Streak {
+	var runs []Streak
+
+	sorted := make([]time.Time, 0, len(days))
+	for d := range days {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	for _, d := range sorted {
+		n := len(runs)
+		if n > 0 && runs[n-1].End.AddDate(0, 0, 1).Equal(d) {
+			runs[n-1].End = d
+			runs[n-1].Days++
+		} else {
+			runs = append(runs, Streak{Start: d, End: d, Days: 1})
+		}
+	}
+	return runs
+}
+
+// longestRun finds the longest of a list of runs, the earliest on ties
+func longestRun(runs []Streak) Streak {
+	var longest Streak
+	for _, r := range runs {
+		if r.Days > longest.Days {
+			longest = r
+		}
+	}
+	return longest
+}
+
+// Streaks finds the longest and current runs of days with plays, with
+// days in tz, and the limit artists with the longest streaks of their own
+func Streaks(db *sql.DB, tz *time.Location, now time.Time, limit int) (StreakStats, error) {
+	stats := StreakStats{Artists: []ArtistStreak{}}
+
+	query := `select a.artist, min(a.artist_id), ` + slotExpr + `
+	from activity a
+	where not ` + isExcluded + `
+	group by a.artist, ` + slotExpr + `;`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	allDays := map[time.Time]bool{}
+	artistDays := map[string]map[time.Time]bool{}
+	artistIDs := map[string]int64{}
+	for rows.Next() {
+		var artist string
+		var artistID, slot int64
+		err = rows.Scan(&artist, &artistID, &slot)
+		if err != nil {
+			return stats, err
+		}
+		day := dayStart(slotTime(slot), tz)
+		allDays[day] = true
+		if artistDays[artist] == nil {
+			artistDays[artist] = map[time.Time]bool{}
+			artistIDs[artist] = artistID
+		}
+		artistDays[artist][day] = true
+	}
+	if err = rows.Err(); err != nil {
+		return stats, err
+	}
+
+	runs := streakRuns(allDays)
+	stats.Longest = longestRun(runs)
+	if len(runs) > 0 {
+		last := runs[len(runs)-1]
+		today := dayStart(now, tz)
+		if !last.End.Before(today.AddDate(0, 0, -1)) {
+			stats.Current = last
+		}
+	}
+
+	for artist, days := range artistDays {
+		// a single day isn't much of a streak
+		if len(days) < 2 {
+			continue
+		}
+		longest := longestRun(streakRuns(days))
+		if longest.Days < 2 {
+			continue
+		}
+		stats.Artists = append(stats.Artists, ArtistStreak{
+			ArtistID: artistIDs[artist],
+			Artist:   artist,
+			Streak:   longest,
+		})
+	}
+	sort.Slice(stats.Artists, func(i, j int) bool {
+		a, b := stats.Artists[i], stats.Artists[j]
+		if a.Streak.Days != b.Streak.Days {
+			return a.Streak.Days > b.Streak.Days
+		}
+		return a.Streak.Start.Before(b.Streak.Start)
+	})
+	if len(stats.Artists) > limit {
+		stats.Artists = stats.Artists[:limit]
+	}
+
+	return stats, nil
+}
+
+// Consistency scores a date range by the fraction of its days
+// with at least one play
+func Consistency(db *sql.DB, params DateRangeParams, now time.Time) (ConsistencyResult, error) {
+	var res ConsistencyResult
+
+	first, ok, err := firstPlay(db)
+	if err != nil || !ok {
+		return res, err
+	}
+
+	// only count days that could have had plays
+	start := params.Start
+	if firstDay := dayStart(first, params.TZ); firstDay.After(start) {
+		start = firstDay
+	}
+	end := params.End
+	if tomorrow := dayStart(now, params.TZ).AddDate(0, 0, 1); tomorrow.Before(end) {
+		end = tomorrow
+	}
+	if !start.Before(end) {
+		return res, nil
+	}
+	daily, err := DailyCounts(db, start, end, params.TZ)
+	if err != nil {
+		return res, err
+	}
+	res.Days = len(daily)
+	for _, d := range daily {
+		if d.PlayCount > 0 {
+			res.ActiveDays++
+		}
+	}
+	res.Score = float64(res.ActiveDays) / float64(res.Days)
+
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCurrentStreak(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	storePlays(t, db, kolkataPlays())
+
+	// kolkataPlays are on march 1, 2 and 4 in india
+	kolkata := loadZone(t, "Asia/Kolkata")
+	march4 := time.Date(2024, time.March, 4, 0, 0, 0, 0, kolkata)
+
+	tests := []struct {
+		now  time.Time
+		days int
+	}{
+		{march4.Add(23 * time.Hour), 1},
+		{march4.AddDate(0, 0, 1).Add(23 * time.Hour), 1}, // yesterday still counts
+		{march4.AddDate(0, 0, 2).Add(time.Hour), 0},
+	}
+	for _, tt := range tests {
+		streaks, err := Streaks(db.SQL, kolkata, tt.now, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if streaks.Current.Days != tt.days {
+			t.Errorf("at %v the current streak is %+v, want %d days", tt.now, streaks.Current, tt.days)
+		}
+		if tt.days > 0 && !streaks.Current.Start.Equal(march4) {
+			t.Errorf("at %v the current streak starts %v, want %v", tt.now, streaks.Current.Start, march4)
+		}
+	}
+
+	// in utc the plays are on march 1 and 3, so there's no streak
+	streaks, err := Streaks(db.SQL, time.UTC, march4, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streaks.Longest.Days != 1 || len(streaks.Artists) != 0 {
+		t.Errorf("utc streaks are %+v", streaks)
+	}
+}
+
+func TestConsistencyHalfHourZone(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	storePlays(t, db, kolkataPlays())
+
+	tests := []struct {
+		zone   string
+		days   int
+		active int
+	}{
+		{"Asia/Kolkata", 5, 3}, // march 1, 2 and 4
+		{"UTC", 5, 2},          // march 1 and 3
+	}
+	for _, tt := range tests {
+		tz := loadZone(t, tt.zone)
+		now := time.Date(2024, time.March, 5, 12, 0, 0, 0, tz)
+		params, err := NewDateRange("month", 0, now, tz, time.Sunday)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := Consistency(db.SQL, params, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// days before the first play and after today don't count
+		if res.Days != tt.days || res.ActiveDays != tt.active ||
+			res.Score != float64(tt.active)/float64(tt.days) {
+			t.Errorf("%s: consistency is %+v, want %d of %d days", tt.zone, res, tt.active, tt.days)
+		}
+	}
+}
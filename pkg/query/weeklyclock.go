@@ -0,0 +1,48 @@
+package query
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WeeklyClockResult counts plays by day of the week and hour of the day,
+// indexed by time.Weekday and then hour. AvgCount is the average over
+// the ClockAvgPeriods periods before the date range, like ListeningClock
+type WeeklyClockResult struct {
+	PlayCount [7][24]int `json:"counts"`
+	AvgCount  [7][24]int `json:"avgCounts"`
+}
+
+// weeklyClockHelper sums play counts over a date range by weekday and
+// hour in a specific timezone
+func weeklyClockHelper(db *sql.DB, start, end time.Time, tz *time.Location) ([7][24]int, error) {
+	var counts [7][24]int
+	err := forEachSlot(db, start, end, func(slot time.Time, count int) {
+		local := slot.In(tz)
+		counts[local.Weekday()][local.Hour()] += count
+	})
+	return counts, err
+}
+
+// WeeklyClock is ListeningClock split up by day of the week
+func WeeklyClock(db *sql.DB, params DateRangeParams) (WeeklyClockResult, error) {
+	var res WeeklyClockResult
+
+	var err error
+	res.PlayCount, err = weeklyClockHelper(db, params.Start, params.End, params.TZ)
+	if err != nil {
+		return res, err
+	}
+
+	avgCount, err := weeklyClockHelper(db, params.PeriodsBefore(ClockAvgPeriods), params.Start, params.TZ)
+	if err != nil {
+		return res, err
+	}
+	for d := range avgCount {
+		for h := range avgCount[d] {
+			res.AvgCount[d][h] = avgCount[d][h] / ClockAvgPeriods
+		}
+	}
+
+	return res, nil
+}
@@ -45,6 +45,12 @@ type LastFMCredentials struct {
 type FetchOptions struct {
 	APIThrottleDelay time.Duration
 	RequestLimit     int // XXX only really ever used for testing
+
+	// From and To refetch the scrobbles between two epoch times (To is
+	// exclusive) instead of everything since the latest one stored.
+	// Scrobbles that are already in the database are skipped
+	From int64
+	To   int64
 }
 
 // FetchResults contains a summary of a fetch operation
@@ -98,11 +104,35 @@ func (this *Fetcher) FetchLatestScrobbles(opts FetchOptions) (FetchResults, erro
 		- recover from a checkpoint file
 		  all values come from the checkpoint
 
+		- resync a range, e.g. to fill a gap reported by doctor
+		  to, from: from the options
+
 	*/
 	var state traversalState
 
-	if checkpointExists() {
+	resync := opts.To != 0
+	skipStored := resync
+	if resync && checkpointExists() {
+		return fetchResults, errors.New("can't resync while there's a checkpoint file, finish that update first")
+	}
+
+	if resync {
+		this.log.Printf("resyncing %v to %v\n", time.Unix(opts.From, 0).UTC(), time.Unix(opts.To, 0).UTC())
+		// the totals are filled in by the first response, they
+		// just need to be set so the state isn't complete already
+		state = traversalState{
+			User:       this.creds.Username,
+			Database:   this.db.Path,
+			Page:       1,
+			TotalPages: 1,
+			From:       opts.From,
+			To:         opts.To,
+		}
+	} else if checkpointExists() {
 		this.log.Println("resuming from checkpoint file")
+		// the checkpoint might be from a resync, which can overlap
+		// scrobbles that are already stored
+		skipStored = true
 		state, err = resumeCheckpoint()
 		if err != nil {
 			return fetchResults, errors.New("error resuming checkpoint")
@@ -162,6 +192,16 @@ func (this *Fetcher) FetchLatestScrobbles(opts FetchOptions) (FetchResults, erro
 		// XXX review error handling here
 		// XXX can StoreActivity return database ids?
 		this.log.Printf("* got %d tracks\n", len(tracks))
+		if skipStored {
+			tracks, err = this.db.FilterStored(tracks)
+			if err != nil {
+				fetchResults.error(err)
+				this.log.Println("error checking for stored tracks")
+				this.log.Println(err)
+				break
+			}
+			this.log.Printf("* %d not stored yet\n", len(tracks))
+		}
 		err = this.db.StoreActivity(tracks)
 		if err != nil {
 			fetchResults.error(err)
@@ -0,0 +1,26 @@
+package web
+
+import (
+	"net/http"
+)
+
+// doctorPage shows the database health report
+func (app *Application) doctorPage(w http.ResponseWriter, r *http.Request) {
+	report, err := app.db.Doctor()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderTemplate(w, "doctor.tmpl", report)
+}
+
+func (app *Application) doctorData(w http.ResponseWriter, r *http.Request) {
+	report, err := app.db.Doctor()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, report)
+}
@@ -21,6 +21,16 @@ type Application struct {
 	session       *sessions.Session
 	Mux           http.Handler
 	templateCache map[string]*template.Template
+
+	// chart histories by timezone and week start
+	chartHistories chartHistoryCache
+
+	// other statistics that scan a lot of the activity
+	stats statsCache
+
+	// clock used for date ranges relative to today, can
+	// be replaced to make them repeatable
+	now func() time.Time
 }
 
 func CreateApp(db *m.Database, staticFileRoot string, sessionSecret string, info, errorLog *log.Logger) (*Application, error) {
@@ -42,6 +52,7 @@ func CreateApp(db *m.Database, staticFileRoot string, sessionSecret string, info
 		err:           errorLog,
 		session:       session,
 		templateCache: templateCache,
+		now:           time.Now,
 	}
 
 	//
@@ -72,6 +83,37 @@ func CreateApp(db *m.Database, staticFileRoot string, sessionSecret string, info
 	mux.Handle("/artists", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
 		app.artistsPage(w, r, "artists.tmpl")
 	}))
+	mux.Handle("/artist/", protectedMiddleware.ThenFunc(app.artistPage))
+	mux.Handle("/album/", protectedMiddleware.ThenFunc(app.albumPage))
+	mux.Handle("/track/", protectedMiddleware.ThenFunc(app.trackPage))
+	mux.Handle("/albums", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.albumsPage(w, r, "albums.tmpl")
+	}))
+	mux.Handle("/sessions", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.sessionsPage(w, r, "sessions.tmpl")
+	}))
+	mux.Handle("/stats", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.statsPage(w, r, "stats.tmpl")
+	}))
+	mux.Handle("/year", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.yearPage(w, r, "year.tmpl")
+	}))
+	mux.Handle("/day", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.dayPage(w, r, "day.tmpl")
+	}))
+	mux.Handle("/onthisday", protectedMiddleware.ThenFunc(app.onThisDayPage))
+	mux.Handle("/records", protectedMiddleware.ThenFunc(app.recordsPage))
+	mux.Handle("/milestones", protectedMiddleware.ThenFunc(app.milestonesPage))
+	mux.Handle("/review/", protectedMiddleware.ThenFunc(app.reviewPage))
+	mux.Handle("/similarity", protectedMiddleware.ThenFunc(app.similarityPage))
+	mux.Handle("/discoveries", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.discoveriesPage(w, r, "discoveries.tmpl")
+	}))
+	mux.Handle("/search", protectedMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.searchPage(w, r, "search.tmpl")
+	}))
+	mux.Handle("/settings", protectedMiddleware.ThenFunc(app.settingsPage))
+	mux.Handle("/admin/doctor", protectedMiddleware.ThenFunc(app.doctorPage))
 
 	// htmx calls
 	mux.Handle("/htmx/recentTracks", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -83,13 +125,55 @@ func CreateApp(db *m.Database, staticFileRoot string, sessionSecret string, info
 	mux.Handle("/htmx/artists", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
 		app.artistsPage(w, r, "artists-fragment.tmpl")
 	}))
+	mux.Handle("/htmx/albums", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.albumsPage(w, r, "albums-fragment.tmpl")
+	}))
+	mux.Handle("/htmx/sessions", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.sessionsPage(w, r, "sessions-fragment.tmpl")
+	}))
+	mux.Handle("/htmx/stats", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.statsPage(w, r, "stats-fragment.tmpl")
+	}))
+	mux.Handle("/htmx/year", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.yearPage(w, r, "year-fragment.tmpl")
+	}))
+	mux.Handle("/htmx/day", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.dayPage(w, r, "recent-fragment.tmpl")
+	}))
+	mux.Handle("/htmx/discoveries", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.discoveriesPage(w, r, "discoveries-fragment.tmpl")
+	}))
+	mux.Handle("/htmx/search", dataMiddleware.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.searchPage(w, r, "search-fragment.tmpl")
+	}))
 
 	// data calls
+	mux.Handle("/data/artist", dataMiddleware.ThenFunc(app.artistData))
+	mux.Handle("/data/album", dataMiddleware.ThenFunc(app.albumData))
+	mux.Handle("/data/track", dataMiddleware.ThenFunc(app.trackData))
 	mux.Handle("/data/topArtists", dataMiddleware.ThenFunc(app.topArtistsData))
 	mux.Handle("/data/topNewArtists", dataMiddleware.ThenFunc(app.topNewArtistsData))
+	mux.Handle("/data/artistTimeSeries", dataMiddleware.ThenFunc(app.artistTimeSeriesData))
+	mux.Handle("/data/chartRecords", dataMiddleware.ThenFunc(app.chartRecordsData))
+	mux.Handle("/data/milestones", dataMiddleware.ThenFunc(app.milestonesData))
+	mux.Handle("/data/review", dataMiddleware.ThenFunc(app.reviewData))
+	mux.Handle("/data/similarity", dataMiddleware.ThenFunc(app.similarityData))
 	mux.Handle("/data/topTracks", dataMiddleware.ThenFunc(app.topTracksData))
+	mux.Handle("/data/topAlbums", dataMiddleware.ThenFunc(app.topAlbumsData))
 	mux.Handle("/data/listeningClock", dataMiddleware.ThenFunc(app.listeningClockData))
+	mux.Handle("/data/albumListens", dataMiddleware.ThenFunc(app.albumListensData))
+	mux.Handle("/data/sessions", dataMiddleware.ThenFunc(app.sessionsData))
+	mux.Handle("/data/streaks", dataMiddleware.ThenFunc(app.streaksData))
+	mux.Handle("/data/consistency", dataMiddleware.ThenFunc(app.consistencyData))
+	mux.Handle("/data/dailyCounts", dataMiddleware.ThenFunc(app.dailyCountsData))
+	mux.Handle("/data/weeklyClock", dataMiddleware.ThenFunc(app.weeklyClockData))
+	mux.Handle("/data/onThisDay", dataMiddleware.ThenFunc(app.onThisDayData))
+	mux.Handle("/data/forgotten", dataMiddleware.ThenFunc(app.forgottenData))
+	mux.Handle("/data/discoveries", dataMiddleware.ThenFunc(app.discoveriesData))
+	mux.Handle("/data/diversity", dataMiddleware.ThenFunc(app.diversityData))
 	mux.Handle("/data/recentTracks", dataMiddleware.ThenFunc(app.recentTracksData))
+	mux.Handle("/data/search", dataMiddleware.ThenFunc(app.searchData))
+	mux.Handle("/data/doctor", dataMiddleware.ThenFunc(app.doctorData))
 
 	// set up static file server to ignore /ui/static/ prefix
 	prefix := path.Join(staticFileRoot, "ui/static/")
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// number of top tracks, albums and days shown for an artist
+const artistDetailLimit = 10
+
+// parseID reads the id of an artist, album or track, writing an error
+// response and returning false if it isn't valid
+func parseID(w http.ResponseWriter, idStr string) (int64, bool) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid value for parameter: id", http.StatusBadRequest)
+		return id, false
+	}
+	return id, true
+}
+
+// loadArtist fetches the history of an artist for the current user,
+// writing an error response and returning false if it can't
+func (app *Application) loadArtist(w http.ResponseWriter, r *http.Request, idStr string) (query.ArtistDetail, bool) {
+	id, ok := parseID(w, idStr)
+	if !ok {
+		return query.ArtistDetail{}, false
+	}
+
+	tz := app.sessionTimezone(r)
+	artist, err := query.ArtistHistory(app.db.SQL, id, tz, artistDetailLimit)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return artist, false
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return artist, false
+	}
+
+	// ranking needs every artist's plays, which are cached
+	months, err := app.artistsByMonth(tz)
+	if err != nil {
+		app.serverError(w, err)
+		return artist, false
+	}
+	artist.Ranks = query.ArtistRanks(months, artist.Name)
+	return artist, true
+}
+
+// artistPage shows everything about a single artist at /artist/{id}
+func (app *Application) artistPage(w http.ResponseWriter, r *http.Request) {
+	artist, ok := app.loadArtist(w, r, strings.TrimPrefix(r.URL.Path, "/artist/"))
+	if !ok {
+		return
+	}
+
+	history, err := app.chartHistory(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	charts, _ := history.Artist(artist.Name)
+
+	type artistTemplateData struct {
+		Artist query.ArtistDetail
+		Charts query.ArtistChartHistory
+	}
+
+	app.renderTemplate(w, "artist.tmpl", artistTemplateData{Artist: artist, Charts: charts})
+}
+
+func (app *Application) artistData(w http.ResponseWriter, r *http.Request) {
+	artist, ok := app.loadArtist(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	type artistResponse struct {
+		query.ArtistDetail
+		Charts query.ArtistChartHistory `json:"charts"`
+	}
+
+	history, err := app.chartHistory(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	charts, _ := history.Artist(artist.Name)
+
+	renderJSON(w, http.StatusOK, artistResponse{ArtistDetail: artist, Charts: charts})
+}
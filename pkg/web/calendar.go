@@ -0,0 +1,260 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// yearly calendar heatmap and single day pages
+
+// heatmap geometry, in svg units
+const (
+	heatmapCell   = 11 // size of a day's square
+	heatmapStep   = 13 // distance between squares
+	heatmapLeft   = 30 // room for weekday labels
+	heatmapTop    = 15 // room for month labels
+	heatmapLevels = 4  // shades for days with plays
+)
+
+type heatmapCellData struct {
+	X, Y  int
+	Level int // 0 for no plays, up to heatmapLevels
+	Link  string
+	Title string
+}
+
+type heatmapLabelData struct {
+	X, Y int
+	Text string
+}
+
+// partial/heatmap.tmpl
+type heatmapTemplateData struct {
+	Width, Height int
+	CellSize      int
+	Cells         []heatmapCellData
+	ColumnLabels  []heatmapLabelData // months or hours
+	RowLabels     []heatmapLabelData
+}
+
+// heatLevel picks the shade for count out of max
+func heatLevel(count, max int) int {
+	if count <= 0 {
+		return 0
+	}
+	return 1 + (count*heatmapLevels-1)/max
+}
+
+// buildHeatmap lays out daily counts as a grid with a column per week
+// and a row per weekday, starting from weekStart
+func buildHeatmap(daily []query.PeriodCount, weekStart time.Weekday) heatmapTemplateData {
+	hm := heatmapTemplateData{
+		CellSize: heatmapCell,
+		Height:   heatmapTop + 7*heatmapStep,
+	}
+	if len(daily) == 0 {
+		return hm
+	}
+
+	max := 0
+	for _, d := range daily {
+		if d.PlayCount > max {
+			max = d.PlayCount
+		}
+	}
+
+	row := func(t time.Time) int { return (int(t.Weekday()) - int(weekStart) + 7) % 7 }
+	lead := row(daily[0].Start)
+
+	for i, d := range daily {
+		col := (lead + i) / 7
+		x := heatmapLeft + col*heatmapStep
+		cell := heatmapCellData{
+			X:     x,
+			Y:     heatmapTop + row(d.Start)*heatmapStep,
+			Link:  "/day?date=" + d.Start.Format("2006-01-02"),
+			Title: fmt.Sprintf("%s: %d plays", d.Start.Format("Mon Jan 2 2006"), d.PlayCount),
+		}
+		cell.Level = heatLevel(d.PlayCount, max)
+		hm.Cells = append(hm.Cells, cell)
+
+		if d.Start.Day() == 1 || i == 0 {
+			hm.ColumnLabels = append(hm.ColumnLabels, heatmapLabelData{X: x, Y: heatmapTop - 4, Text: d.Start.Format("Jan")})
+		}
+		hm.Width = x + heatmapStep
+	}
+
+	// label every other row, like github
+	for r := 1; r < 7; r += 2 {
+		day := time.Weekday((int(weekStart) + r) % 7)
+		hm.RowLabels = append(hm.RowLabels, heatmapLabelData{
+			X:    0,
+			Y:    heatmapTop + r*heatmapStep + heatmapCell - 1,
+			Text: day.String()[:3],
+		})
+	}
+	return hm
+}
+
+// buildWeeklyHeatmap lays out a weekly clock as a grid with a column per
+// hour and a row per weekday, starting from weekStart. Shades are scaled
+// to max so that more than one grid can be compared
+func buildWeeklyHeatmap(counts [7][24]int, weekStart time.Weekday, max int) heatmapTemplateData {
+	hm := heatmapTemplateData{
+		CellSize: heatmapCell,
+		Width:    heatmapLeft + 24*heatmapStep,
+		Height:   heatmapTop + 7*heatmapStep,
+	}
+
+	for r := 0; r < 7; r++ {
+		day := time.Weekday((int(weekStart) + r) % 7)
+		y := heatmapTop + r*heatmapStep
+		for h := 0; h < 24; h++ {
+			hm.Cells = append(hm.Cells, heatmapCellData{
+				X:     heatmapLeft + h*heatmapStep,
+				Y:     y,
+				Level: heatLevel(counts[day][h], max),
+				Title: fmt.Sprintf("%s %02d:00: %d plays", day.String()[:3], h, counts[day][h]),
+			})
+		}
+		hm.RowLabels = append(hm.RowLabels, heatmapLabelData{X: 0, Y: y + heatmapCell - 1, Text: day.String()[:3]})
+	}
+	for h := 0; h < 24; h += 3 {
+		hm.ColumnLabels = append(hm.ColumnLabels, heatmapLabelData{
+			X:    heatmapLeft + h*heatmapStep,
+			Y:    heatmapTop - 4,
+			Text: strconv.Itoa(h),
+		})
+	}
+	return hm
+}
+
+// yearPage shows a heatmap of daily plays for a calendar year, the
+// current one unless the year parameter is given
+func (app *Application) yearPage(w http.ResponseWriter, r *http.Request, templateName string) {
+	tz := app.sessionTimezone(r)
+
+	year := app.now().In(tz).Year()
+	if yearStr := r.URL.Query().Get("year"); yearStr != "" {
+		var err error
+		year, err = strconv.Atoi(yearStr)
+		if err != nil {
+			http.Error(w, "invalid format for parameter: year", http.StatusBadRequest)
+			return
+		}
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, tz)
+	end := start.AddDate(1, 0, 0)
+	daily, err := query.DailyCounts(app.db.SQL, start, end, tz)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	type yearTemplateData struct {
+		Year       int
+		TotalPlays int
+		ActiveDays int
+		Busiest    query.PeriodCount
+		Heatmap    heatmapTemplateData
+		PagingData datebarTemplateData
+	}
+
+	dat := yearTemplateData{
+		Year:    year,
+		Heatmap: buildHeatmap(daily, app.sessionWeekStart(r)),
+		PagingData: datebarTemplateData{
+			Title:     fmt.Sprintf("Listening in %d", year),
+			Previous:  fmt.Sprintf("/htmx/year?year=%d", year-1),
+			DOMTarget: "#year-pagegrid",
+		},
+	}
+	if end.Before(app.now()) {
+		dat.PagingData.Next = fmt.Sprintf("/htmx/year?year=%d", year+1)
+	}
+	for _, d := range daily {
+		dat.TotalPlays += d.PlayCount
+		if d.PlayCount > 0 {
+			dat.ActiveDays++
+		}
+		if d.PlayCount > dat.Busiest.PlayCount {
+			dat.Busiest = d
+		}
+	}
+
+	app.renderTemplate(w, templateName, dat)
+}
+
+// dayPage shows every play on the day given by the date parameter
+func (app *Application) dayPage(w http.ResponseWriter, r *http.Request, templateName string) {
+	tz := app.sessionTimezone(r)
+
+	day, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("date"), tz)
+	if err != nil {
+		http.Error(w, "invalid format for parameter: date", http.StatusBadRequest)
+		return
+	}
+
+	plays, err := query.DayPlays(app.db.SQL, day, tz)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	dayLink := func(t time.Time) string {
+		return "/htmx/day?date=" + t.Format("2006-01-02")
+	}
+
+	tmp := recentTemplateData{
+		PagingData: datebarTemplateData{
+			Title:     "Played on " + day.Format("Mon Jan 2 2006"),
+			Previous:  dayLink(day.AddDate(0, 0, -1)),
+			DOMTarget: "#monthly-pagegrid",
+		},
+		Tracks: plays,
+	}
+	if next := day.AddDate(0, 0, 1); next.Before(app.now()) {
+		tmp.PagingData.Next = dayLink(next)
+	}
+
+	app.renderTemplate(w, templateName, tmp)
+}
+
+func (app *Application) dailyCountsData(w http.ResponseWriter, r *http.Request) {
+
+	type dailyCountsResponse struct {
+		Mode      string              `json:"mode"`
+		StartDate time.Time           `json:"startDate"`
+		EndDate   time.Time           `json:"endDate"`
+		Days      []query.PeriodCount `json:"days"`
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.Mode == "all" {
+		// every day since 1970 isn't useful
+		http.Error(w, "invalid value for parameter: mode", http.StatusBadRequest)
+		return
+	}
+
+	daily, err := query.DailyCounts(app.db.SQL, params.Start, params.End, params.TZ)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, dailyCountsResponse{
+		Mode:      params.Mode,
+		StartDate: params.Start,
+		EndDate:   params.End,
+		Days:      daily,
+	})
+}
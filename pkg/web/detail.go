@@ -0,0 +1,117 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// track and album drill-downs
+
+// detailClockData builds the listening clock chart for a single
+// track or album, which has no average to compare against
+func detailClockData(clock []int) clockTemplateData {
+	return clockTemplateData{
+		GraphTitle:    "Listening Times",
+		AvgLabel:      "",
+		CurrentValues: clock,
+		AverageValues: []int{},
+	}
+}
+
+// loadTrack fetches the history of a track for the current user,
+// writing an error response and returning false if it can't
+func (app *Application) loadTrack(w http.ResponseWriter, r *http.Request, idStr string) (query.TrackDetail, bool) {
+	id, ok := parseID(w, idStr)
+	if !ok {
+		return query.TrackDetail{}, false
+	}
+
+	track, err := query.TrackHistory(app.db.SQL, id, app.sessionTimezone(r), app.sessionGap(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return track, false
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return track, false
+	}
+	return track, true
+}
+
+// trackPage shows every play of a single track at /track/{id}
+func (app *Application) trackPage(w http.ResponseWriter, r *http.Request) {
+	track, ok := app.loadTrack(w, r, strings.TrimPrefix(r.URL.Path, "/track/"))
+	if !ok {
+		return
+	}
+
+	type trackDetailTemplateData struct {
+		Track     query.TrackDetail
+		ClockData clockTemplateData
+	}
+
+	app.renderTemplate(w, "track.tmpl", trackDetailTemplateData{
+		Track:     track,
+		ClockData: detailClockData(track.Clock),
+	})
+}
+
+func (app *Application) trackData(w http.ResponseWriter, r *http.Request) {
+	track, ok := app.loadTrack(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	renderJSON(w, http.StatusOK, track)
+}
+
+// loadAlbum fetches the history of an album for the current user,
+// writing an error response and returning false if it can't
+func (app *Application) loadAlbum(w http.ResponseWriter, r *http.Request, idStr string) (query.AlbumDetail, bool) {
+	id, ok := parseID(w, idStr)
+	if !ok {
+		return query.AlbumDetail{}, false
+	}
+
+	album, err := query.AlbumHistory(app.db.SQL, id, app.sessionTimezone(r), app.sessionGap(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return album, false
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return album, false
+	}
+	return album, true
+}
+
+// albumPage shows every play of a single album at /album/{id}
+func (app *Application) albumPage(w http.ResponseWriter, r *http.Request) {
+	album, ok := app.loadAlbum(w, r, strings.TrimPrefix(r.URL.Path, "/album/"))
+	if !ok {
+		return
+	}
+
+	type albumDetailTemplateData struct {
+		Album     query.AlbumDetail
+		ClockData clockTemplateData
+	}
+
+	app.renderTemplate(w, "album.tmpl", albumDetailTemplateData{
+		Album:     album,
+		ClockData: detailClockData(album.Clock),
+	})
+}
+
+func (app *Application) albumData(w http.ResponseWriter, r *http.Request) {
+	album, ok := app.loadAlbum(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	renderJSON(w, http.StatusOK, album)
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// extractDiscoveryParams reads optional minArtistPlays, minAlbumPlays,
+// minTrackPlays and limit parameters over the defaults
+func extractDiscoveryParams(r *http.Request) (query.DiscoveryParams, error) {
+	params := query.DefaultDiscoveryParams()
+
+	for name, field := range map[string]*int{
+		"minArtistPlays": &params.MinArtistPlays,
+		"minAlbumPlays":  &params.MinAlbumPlays,
+		"minTrackPlays":  &params.MinTrackPlays,
+		"limit":          &params.Limit,
+	} {
+		str := r.URL.Query().Get(name)
+		if str == "" {
+			continue
+		}
+		val, err := strconv.Atoi(str)
+		if err != nil || val < 0 {
+			return params, errors.New("invalid value for parameter: " + name)
+		}
+		*field = val
+	}
+	return params, nil
+}
+
+// discoveryURLParams encodes the discovery params that aren't the
+// defaults, so paging through dates keeps them
+func discoveryURLParams(dp query.DiscoveryParams) string {
+	def := query.DefaultDiscoveryParams()
+	vals := url.Values{}
+	for _, p := range []struct {
+		name       string
+		val, unset int
+	}{
+		{"minArtistPlays", dp.MinArtistPlays, def.MinArtistPlays},
+		{"minAlbumPlays", dp.MinAlbumPlays, def.MinAlbumPlays},
+		{"minTrackPlays", dp.MinTrackPlays, def.MinTrackPlays},
+		{"limit", dp.Limit, def.Limit},
+	} {
+		if p.val != p.unset {
+			vals.Set(p.name, strconv.Itoa(p.val))
+		}
+	}
+	if len(vals) == 0 {
+		return ""
+	}
+	return "?" + vals.Encode()
+}
+
+func (app *Application) discoveriesPage(w http.ResponseWriter, r *http.Request, templateName string) {
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dp, err := extractDiscoveryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	discoveries, err := query.Discover(app.db.SQL, params, dp)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	type discoveriesTemplateData struct {
+		Discoveries query.Discoveries
+		Params      query.DiscoveryParams
+		Offset      int // of the date range, for the thresholds form
+		PagingData  datebarTemplateData
+	}
+
+	dat := discoveriesTemplateData{
+		Discoveries: discoveries,
+		Params:      dp,
+		Offset:      params.Offset,
+		PagingData: app.dateRangeBar(params, "Discoveries",
+			"/htmx/discoveries"+discoveryURLParams(dp), "#discoveries-pagegrid"),
+	}
+
+	app.renderTemplate(w, templateName, dat)
+}
+
+func (app *Application) discoveriesData(w http.ResponseWriter, r *http.Request) {
+
+	type discoveriesResponse struct {
+		Mode      string    `json:"mode"`
+		StartDate time.Time `json:"startDate"`
+		EndDate   time.Time `json:"endDate"`
+		query.Discoveries
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dp, err := extractDiscoveryParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	discoveries, err := query.Discover(app.db.SQL, params, dp)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, discoveriesResponse{
+		Mode:        params.Mode,
+		StartDate:   params.Start,
+		EndDate:     params.End,
+		Discoveries: discoveries,
+	})
+}
@@ -5,14 +5,22 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
 	"bitbucket.org/grgbrn/localfm/pkg/query"
 )
 
+// number of recent album listens shown beside the track chart
+const albumListenTileLimit = 5
+
+// number of artists followed through the artist share charts
+const artistSeriesLimit = 10
+
 // login pages
 func (app *Application) loginUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
@@ -134,7 +142,7 @@ func (app *Application) tracksPage(w http.ResponseWriter, r *http.Request, templ
 
 	// XXX i have 3 queries to perform here, do them in parallel?
 
-	topTracks, err := query.TopTracks(app.db.SQL, params)
+	trackChart, err := app.trackChart(params)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -152,27 +160,16 @@ func (app *Application) tracksPage(w http.ResponseWriter, r *http.Request, templ
 		return
 	}
 
-	// generate next/previous links
-	var nextLink, prevLink string
-	prevLink = fmt.Sprintf("/htmx/popularTracks?offset=%d&mode=%s", params.Offset+1, params.Mode)
-	if params.Offset > 0 {
-		nextLink = fmt.Sprintf("/htmx/popularTracks?offset=%d&mode=%s", params.Offset-1, params.Mode)
+	weeklyClock, err := query.WeeklyClock(app.db.SQL, params)
+	if err != nil {
+		app.serverError(w, err)
+		return
 	}
 
-	// generate title
-	var pagingTitle string
-	switch params.Mode {
-	case "week":
-		// mimic javascript toDateString()
-		// "Thu Jan 12 2023"
-		const dateStringFormat = "Mon Jan 2 2006"
-		start := params.Start.Format(dateStringFormat)
-		end := params.End.Format(dateStringFormat)
-		pagingTitle = start + " to " + end
-	case "month":
-		pagingTitle = params.Start.Format("Jan 2006")
-	case "year":
-		pagingTitle = params.Start.Format("2006")
+	albumListens, err := query.AlbumListens(app.db.SQL, params, albumListenTileLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
 	}
 
 	// listening clock current/avg values
@@ -183,25 +180,41 @@ func (app *Application) tracksPage(w http.ResponseWriter, r *http.Request, templ
 		avgClockValues[ix] = val.AvgCount
 	}
 
-	unitTitle := titleCase(params.Mode)
+	// weekly clock heatmaps share a scale so they can be compared
+	weekStart := app.sessionWeekStart(r)
+	weeklyMax := 0
+	for d := range weeklyClock.PlayCount {
+		for h := range weeklyClock.PlayCount[d] {
+			if weeklyClock.PlayCount[d][h] > weeklyMax {
+				weeklyMax = weeklyClock.PlayCount[d][h]
+			}
+			if weeklyClock.AvgCount[d][h] > weeklyMax {
+				weeklyMax = weeklyClock.AvgCount[d][h]
+			}
+		}
+	}
+	weeklyAvg := buildWeeklyHeatmap(weeklyClock.AvgCount, weekStart, weeklyMax)
+
+	// "all" has no earlier periods to average
+	if params.Mode == "all" {
+		avgClockValues = []int{}
+		weeklyAvg.Cells = nil
+	}
 
 	tmp := trackTemplateData{
-		TopTracks:  topTracks,
-		TopArtists: topArtists,
+		TopTracks:    trackChart.Tracks,
+		Dropouts:     trackChart.Dropouts,
+		TopArtists:   topArtists,
+		AlbumListens: albumListens,
 		ClockData: clockTemplateData{
-			GraphTitle:    unitTitle + "ly Listening Times",
-			AvgLabel:      "6 " + unitTitle + " avg",
+			GraphTitle:    clockTitle(params.Mode),
+			AvgLabel:      fmt.Sprintf("%d %s avg", query.ClockAvgPeriods, unitLabel(params.Mode)),
 			CurrentValues: currentClockValues,
 			AverageValues: avgClockValues,
 		},
-		PagingData: datebarTemplateData{
-			Title:        "Popular Tracks: " + pagingTitle,
-			UnitLabel:    unitTitle,
-			DOMTarget:    "#monthly-pagegrid",
-			Previous:     prevLink,
-			Next:         nextLink,
-			DateRangeURL: "/htmx/popularTracks",
-		},
+		WeeklyClock: buildWeeklyHeatmap(weeklyClock.PlayCount, weekStart, weeklyMax),
+		WeeklyAvg:   weeklyAvg,
+		PagingData:  app.dateRangeBar(params, "Popular Tracks", "/htmx/popularTracks", "#monthly-pagegrid"),
 	}
 
 	app.renderTemplate(w, templateName, tmp)
@@ -215,56 +228,216 @@ func (app *Application) artistsPage(w http.ResponseWriter, r *http.Request, temp
 		return
 	}
 
-	artists, err := query.TopArtists(app.db.SQL, params)
+	artistChart, err := app.artistChart(params)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// generate next/previous links
-	var nextLink, prevLink string
-	prevLink = fmt.Sprintf("/htmx/artists?offset=%d&mode=%s", params.Offset+1, params.Mode)
-	if params.Offset > 0 {
-		nextLink = fmt.Sprintf("/htmx/artists?offset=%d&mode=%s", params.Offset-1, params.Mode)
+	seriesParams := params
+	seriesParams.Limit = artistSeriesLimit
+	series, err := query.ArtistTimeSeries(app.db.SQL, seriesParams, seriesInterval(params), false)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	type artistTemplateData struct {
+		Artists    []query.ArtistResult
+		Dropouts   []query.ArtistResult
+		Series     query.ArtistTimeSeriesResult
+		Race       query.ArtistTimeSeriesResult
+		PagingData datebarTemplateData
+	}
+
+	dat := artistTemplateData{
+		Artists:    artistChart.Artists,
+		Dropouts:   artistChart.Dropouts,
+		Series:     series,
+		Race:       series.Accumulate(),
+		PagingData: app.dateRangeBar(params, "Recent Artists", "/htmx/artists", "#artist-pagegrid"),
+	}
+
+	app.renderTemplate(w, templateName, dat)
+}
+
+func (app *Application) albumsPage(w http.ResponseWriter, r *http.Request, templateName string) {
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	albums, err := query.TopAlbums(app.db.SQL, params)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// summarizing album listens needs every play in the range,
+	// which is too many over all time
+	var listens []query.AlbumListen
+	if params.Mode != "all" {
+		listens, err = query.AlbumListens(app.db.SQL, params, 0)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	type albumTemplateData struct {
+		Albums       []query.AlbumResult
+		AlbumListens query.AlbumListenStats
+		AllTime      bool
+		PagingData   datebarTemplateData
+	}
+
+	dat := albumTemplateData{
+		Albums:       albums,
+		AlbumListens: query.SummarizeAlbumListens(listens),
+		AllTime:      params.Mode == "all",
+		PagingData:   app.dateRangeBar(params, "Top Albums", "/htmx/albums", "#album-pagegrid"),
+	}
+
+	app.renderTemplate(w, templateName, dat)
+}
+
+func (app *Application) searchPage(w http.ResponseWriter, r *http.Request, templateName string) {
+
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	type searchTemplateData struct {
+		query.SearchResults
+		Unavailable bool // built without the search index
+	}
+	dat := searchTemplateData{Unavailable: !m.SearchAvailable()}
+
+	// the page is loaded without a query, only the fragment
+	// is fetched with one
+	if text != "" && !dat.Unavailable {
+		var err error
+		dat.SearchResults, err = query.Search(app.db.SQL, text, 20)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		dat.InTimezone(app.sessionTimezone(r))
 	}
 
-	// XXX factor this out, used in multiple handlers
-	// generate title
-	var pagingTitle string
+	app.renderTemplate(w, templateName, dat)
+}
+
+// dateRangeTitle describes the period covered by a date range
+// for the datebar title
+func dateRangeTitle(params query.DateRangeParams) string {
 	switch params.Mode {
+	case "day":
+		return params.Start.Format("Mon Jan 2 2006")
 	case "week":
 		// mimic javascript toDateString()
 		// "Thu Jan 12 2023"
 		const dateStringFormat = "Mon Jan 2 2006"
 		start := params.Start.Format(dateStringFormat)
 		end := params.End.Format(dateStringFormat)
-		pagingTitle = start + " to " + end
+		return start + " to " + end
+	case "calweek":
+		const dateStringFormat = "Mon Jan 2 2006"
+		start := params.Start.Format(dateStringFormat)
+		end := params.LastDay().Format(dateStringFormat)
+		return start + " to " + end
+	case "isoweek":
+		year, week := params.Start.ISOWeek()
+		return fmt.Sprintf("Week %d %d (%s to %s)", week, year,
+			params.Start.Format("Mon Jan 2"), params.LastDay().Format("Mon Jan 2"))
 	case "month":
-		pagingTitle = params.Start.Format("Jan 2006")
+		return params.Start.Format("Jan 2006")
+	case "quarter":
+		return fmt.Sprintf("Q%d %d", (int(params.Start.Month())+2)/3, params.Start.Year())
 	case "year":
-		pagingTitle = params.Start.Format("2006")
+		return params.Start.Format("2006")
+	case "all":
+		return "All Time"
+	case "custom":
+		const dateStringFormat = "Mon Jan 2 2006"
+		start := params.Start.Format(dateStringFormat)
+		end := params.LastDay().Format(dateStringFormat)
+		if start == end {
+			return start
+		}
+		return start + " to " + end
 	}
+	return ""
+}
 
-	unitTitle := titleCase(params.Mode)
+// unitLabel names a single period of a date range mode,
+// for "Previous Week" style links
+func unitLabel(mode string) string {
+	switch mode {
+	case "calweek", "isoweek":
+		return "Week"
+	case "all":
+		return "All Time"
+	case "custom":
+		return "Range"
+	}
+	return titleCase(mode)
+}
 
-	type artistTemplateData struct {
-		Artists    []query.ArtistResult
-		PagingData datebarTemplateData
+// clockTitle is the title of the listening clock for a date range mode
+func clockTitle(mode string) string {
+	switch mode {
+	case "day":
+		return "Daily Listening Times"
+	case "calweek", "isoweek":
+		return "Weekly Listening Times"
+	case "all", "custom":
+		return "Listening Times"
+	}
+	return titleCase(mode) + "ly Listening Times"
+}
+
+// dateRangeBar builds the datebar for a page of results over a date
+// range. url is the htmx endpoint that renders the page into target,
+// which can have parameters of its own
+func (app *Application) dateRangeBar(params query.DateRangeParams, title, url, target string) datebarTemplateData {
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
 	}
 
-	dat := artistTemplateData{
-		Artists: artists,
-		PagingData: datebarTemplateData{
-			Title:        "Recent Artists: " + pagingTitle,
-			UnitLabel:    unitTitle,
-			DOMTarget:    "#artist-pagegrid",
-			Previous:     prevLink,
-			Next:         nextLink,
-			DateRangeURL: "/htmx/artists",
-		},
+	bar := datebarTemplateData{
+		Title:        title + ": " + dateRangeTitle(params),
+		UnitLabel:    unitLabel(params.Mode),
+		Mode:         params.Mode,
+		StartDate:    params.Start.Format("2006-01-02"),
+		EndDate:      params.LastDay().Format("2006-01-02"),
+		DOMTarget:    target,
+		DateRangeURL: url,
 	}
 
-	app.renderTemplate(w, templateName, dat)
+	switch params.Mode {
+	case "all":
+		// nothing before or after
+	case "custom":
+		// page by ranges of the same length, as long as
+		// they don't start in the future
+		rangeLink := func(p query.DateRangeParams) string {
+			return fmt.Sprintf("%s%smode=custom&start=%s&end=%s", url, sep,
+				p.Start.Format("2006-01-02"), p.LastDay().Format("2006-01-02"))
+		}
+		bar.Previous = rangeLink(params.Shift(1))
+		next := params.Shift(-1)
+		if next.Start.Before(app.now()) {
+			bar.Next = rangeLink(next)
+		}
+	default:
+		bar.Previous = fmt.Sprintf("%s%soffset=%d&mode=%s", url, sep, params.Offset+1, params.Mode)
+		if params.Offset > 0 {
+			bar.Next = fmt.Sprintf("%s%soffset=%d&mode=%s", url, sep, params.Offset-1, params.Mode)
+		}
+	}
+	return bar
 }
 
 func extractOffsetParams(r *http.Request) (query.OffsetParams, error) {
@@ -295,34 +468,17 @@ func extractOffsetParams(r *http.Request) (query.OffsetParams, error) {
 	return result, nil
 }
 
-// extractDateRangeParams translates mode=X&offset=Y parameters
-// from the URL query into start/end/lim parameters expected by
-// the query package
+// extractDateRangeParams translates mode=X&offset=Y or start=X&end=Y
+// parameters from the URL query into start/end/lim parameters expected
+// by the query package
 func (app *Application) extractDateRangeParams(r *http.Request) (query.DateRangeParams, error) {
 
 	var params query.DateRangeParams
 
-	// required param: mode
-	mode := r.URL.Query().Get("mode")
-	if mode == "" {
-		mode = "month"
-	}
-	params.Mode = mode
-
-	// required param: offset
-	offStr := r.URL.Query().Get("offset")
-	if offStr == "" {
-		offStr = "0"
-	}
-	offset, err := strconv.Atoi(offStr)
-	if err != nil {
-		return params, errors.New("invalid format for parameter: offset")
-	}
-	params.Offset = offset
-
 	// optional param: tz
 	// if unset, try the value in the session
 	// otherwise default to UTC
+	tz := time.UTC
 	tzStr := r.URL.Query().Get("tz")
 	if tzStr == "" {
 		tzStr = app.session.GetString(r, "timezone")
@@ -332,45 +488,95 @@ func (app *Application) extractDateRangeParams(r *http.Request) (query.DateRange
 		if err != nil {
 			fmt.Printf("Error loading timezone:%s %v", tzStr, err)
 		} else {
-			params.TZ = loc
+			tz = loc
+		}
+	}
+
+	// optional params: start & end
+	// an explicit range of days takes precedence over mode & offset
+	startStr := r.URL.Query().Get("start")
+	endStr := r.URL.Query().Get("end")
+	if startStr != "" || endStr != "" {
+		if startStr == "" || endStr == "" {
+			return params, errors.New("start and end parameters must be used together")
 		}
+		return query.CustomDateRange(startStr, endStr, tz)
+	}
+
+	// optional param: mode
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "month"
+	}
+
+	// optional param: offset
+	offStr := r.URL.Query().Get("offset")
+	if offStr == "" {
+		offStr = "0"
 	}
-	if params.TZ == nil {
-		params.TZ = time.UTC
+	offset, err := strconv.Atoi(offStr)
+	if err != nil {
+		return params, errors.New("invalid format for parameter: offset")
 	}
 
 	// optional param: count
 	// XXX client never actually changes the value
 	// countStr := r.URL.Query().Get("count")
-	params.Limit = 20
-
-	// compute start/end dates from mode & offset
-	// XXX refactor this to be unit-testable and not depend on Now()
-	now := time.Now()
-
-	if mode == "week" {
-		// show week ending today / last 7 days
-		tmp := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, params.TZ)
-		params.End = tmp.AddDate(0, 0, -offset*7)
-		params.Start = params.End.AddDate(0, 0, -7)
-	} else if mode == "month" {
-		// show month to date (inconsistent with week)
-		tmp := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, params.TZ)
-		params.Start = tmp.AddDate(0, -offset, 0)
-		params.End = params.Start.AddDate(0, 1, 0)
-	} else if mode == "year" {
-		y := now.Year()
-		y -= offset
-		params.Start = time.Date(y, time.January, 1, 0, 0, 0, 0, params.TZ)
-		params.End = params.Start.AddDate(1, 0, 0)
-	} else {
-		return params, errors.New("invalid value for parameter: mode")
+
+	params, err = query.NewDateRange(mode, offset, app.now(), tz, app.sessionWeekStart(r))
+	if err != nil {
+		return params, err
 	}
 
 	fmt.Printf("{%s %s %d}\n", params.StartString(), params.EndString(), params.Limit)
 	return params, nil
 }
 
+// sessionWeekStart returns the first day of a calendar week chosen
+// on the settings page, or Sunday if it hasn't been set
+func (app *Application) sessionWeekStart(r *http.Request) time.Weekday {
+	name := app.session.GetString(r, "weekStart")
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if d.String() == name {
+			return d
+		}
+	}
+	return time.Sunday
+}
+
+// sessionTimezone returns the timezone the user logged in from,
+// or UTC if it's unknown
+func (app *Application) sessionTimezone(r *http.Request) *time.Location {
+	tzStr := app.session.GetString(r, "timezone")
+	if tzStr != "" {
+		loc, err := time.LoadLocation(tzStr)
+		if err == nil {
+			return loc
+		}
+		fmt.Printf("Error loading timezone:%s %v", tzStr, err)
+	}
+	return time.UTC
+}
+
+// trackChart finds the top tracks for a date range with their movement
+// since the previous period. "all" has no previous period to compare with
+func (app *Application) trackChart(params query.DateRangeParams) (query.TrackChart, error) {
+	if params.Mode == "all" {
+		tracks, err := query.TopTracks(app.db.SQL, params)
+		return query.TrackChart{Tracks: tracks, Dropouts: []query.TrackResult{}}, err
+	}
+	return query.CompareTopTracks(app.db.SQL, params, params.Shift(1))
+}
+
+// artistChart is trackChart for artists
+func (app *Application) artistChart(params query.DateRangeParams) (query.ArtistChart, error) {
+	if params.Mode == "all" {
+		artists, err := query.TopArtists(app.db.SQL, params)
+		return query.ArtistChart{Artists: artists, Dropouts: []query.ArtistResult{}}, err
+	}
+	return query.CompareTopArtists(app.db.SQL, params, params.Shift(1))
+}
+
 // json data handlers
 func (app *Application) topArtistsData(w http.ResponseWriter, r *http.Request) {
 
@@ -379,6 +585,7 @@ func (app *Application) topArtistsData(w http.ResponseWriter, r *http.Request) {
 		StartDate time.Time            `json:"startDate"`
 		EndDate   time.Time            `json:"endDate"`
 		Artists   []query.ArtistResult `json:"artists"`
+		Dropouts  []query.ArtistResult `json:"dropouts"`
 	}
 
 	params, err := app.extractDateRangeParams(r)
@@ -387,7 +594,7 @@ func (app *Application) topArtistsData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	artists, err := query.TopArtists(app.db.SQL, params)
+	chart, err := app.artistChart(params)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -397,7 +604,72 @@ func (app *Application) topArtistsData(w http.ResponseWriter, r *http.Request) {
 		Mode:      params.Mode,
 		StartDate: params.Start,
 		EndDate:   params.End,
-		Artists:   artists,
+		Artists:   chart.Artists,
+		Dropouts:  chart.Dropouts,
+	})
+}
+
+// seriesInterval picks weeks for time series over a few months
+// or less and months for anything longer
+func seriesInterval(params query.DateRangeParams) string {
+	if params.Mode == "all" || params.Days() > 92 {
+		return "month"
+	}
+	return "week"
+}
+
+func (app *Application) artistTimeSeriesData(w http.ResponseWriter, r *http.Request) {
+
+	type artistTimeSeriesResponse struct {
+		Mode      string    `json:"mode"`
+		StartDate time.Time `json:"startDate"`
+		EndDate   time.Time `json:"endDate"`
+		query.ArtistTimeSeriesResult
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params.Limit = artistSeriesLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		params.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || params.Limit < 0 {
+			http.Error(w, "invalid value for parameter: limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = seriesInterval(params)
+	} else if interval != "week" && interval != "month" {
+		http.Error(w, "invalid value for parameter: interval", http.StatusBadRequest)
+		return
+	}
+
+	cumulative := false
+	if cumulativeStr := r.URL.Query().Get("cumulative"); cumulativeStr != "" {
+		cumulative, err = strconv.ParseBool(cumulativeStr)
+		if err != nil {
+			http.Error(w, "invalid value for parameter: cumulative", http.StatusBadRequest)
+			return
+		}
+	}
+
+	series, err := query.ArtistTimeSeries(app.db.SQL, params, interval, cumulative)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, artistTimeSeriesResponse{
+		Mode:                   params.Mode,
+		StartDate:              params.Start,
+		EndDate:                params.End,
+		ArtistTimeSeriesResult: series,
 	})
 }
 
@@ -438,6 +710,7 @@ func (app *Application) topTracksData(w http.ResponseWriter, r *http.Request) {
 		StartDate time.Time           `json:"startDate"`
 		EndDate   time.Time           `json:"endDate"`
 		Tracks    []query.TrackResult `json:"tracks"`
+		Dropouts  []query.TrackResult `json:"dropouts"`
 	}
 
 	params, err := app.extractDateRangeParams(r)
@@ -446,7 +719,7 @@ func (app *Application) topTracksData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	topTracks, err := query.TopTracks(app.db.SQL, params)
+	chart, err := app.trackChart(params)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -456,7 +729,70 @@ func (app *Application) topTracksData(w http.ResponseWriter, r *http.Request) {
 		Mode:      params.Mode,
 		StartDate: params.Start,
 		EndDate:   params.End,
-		Tracks:    topTracks,
+		Tracks:    chart.Tracks,
+		Dropouts:  chart.Dropouts,
+	})
+}
+
+func (app *Application) topAlbumsData(w http.ResponseWriter, r *http.Request) {
+
+	type topAlbumsResponse struct {
+		Mode      string              `json:"mode"`
+		StartDate time.Time           `json:"startDate"`
+		EndDate   time.Time           `json:"endDate"`
+		Albums    []query.AlbumResult `json:"albums"`
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	albums, err := query.TopAlbums(app.db.SQL, params)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, topAlbumsResponse{
+		Mode:      params.Mode,
+		StartDate: params.Start,
+		EndDate:   params.End,
+		Albums:    albums,
+	})
+}
+
+func (app *Application) albumListensData(w http.ResponseWriter, r *http.Request) {
+
+	type albumListensResponse struct {
+		Mode      string                 `json:"mode"`
+		StartDate time.Time              `json:"startDate"`
+		EndDate   time.Time              `json:"endDate"`
+		Stats     query.AlbumListenStats `json:"stats"`
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.Mode == "all" {
+		http.Error(w, "album listens can't be summarized over all time", http.StatusBadRequest)
+		return
+	}
+
+	listens, err := query.AlbumListens(app.db.SQL, params, 0)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, albumListensResponse{
+		Mode:      params.Mode,
+		StartDate: params.Start,
+		EndDate:   params.End,
+		Stats:     query.SummarizeAlbumListens(listens),
 	})
 }
 
@@ -520,6 +856,56 @@ func (app *Application) listeningClockData(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+func (app *Application) weeklyClockData(w http.ResponseWriter, r *http.Request) {
+
+	type weeklyClockResponse struct {
+		Mode      string                  `json:"mode"`
+		StartDate time.Time               `json:"startDate"`
+		EndDate   time.Time               `json:"endDate"`
+		Clock     query.WeeklyClockResult `json:"clock"`
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clock, err := query.WeeklyClock(app.db.SQL, params)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, weeklyClockResponse{
+		Mode:      params.Mode,
+		StartDate: params.Start,
+		EndDate:   params.End,
+		Clock:     clock,
+	})
+}
+
+func (app *Application) searchData(w http.ResponseWriter, r *http.Request) {
+
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		http.Error(w, "missing parameter: q", http.StatusBadRequest)
+		return
+	}
+
+	results, err := query.Search(app.db.SQL, text, 20)
+	if err == m.ErrSearchUnavailable {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, results)
+}
+
 func titleCase(s string) string {
 	c := cases.Title(language.English)
 	return c.String(s)
@@ -538,6 +924,9 @@ type recentTemplateData struct {
 type datebarTemplateData struct {
 	Title        string
 	UnitLabel    string // XXX document this
+	Mode         string // selected date range mode
+	StartDate    string // first and last day of a custom range
+	EndDate      string
 	DOMTarget    string
 	Previous     string
 	Next         string
@@ -555,8 +944,13 @@ type clockTemplateData struct {
 
 // tracks.page.tmpl
 type trackTemplateData struct {
-	TopTracks  []query.TrackResult
-	TopArtists []query.ArtistResult
-	ClockData  clockTemplateData
-	PagingData datebarTemplateData
+	TopTracks    []query.TrackResult
+	AlbumListens []query.AlbumListen
+	Dropouts     []query.TrackResult
+	TopArtists   []query.ArtistResult
+	ClockData    clockTemplateData
+	// weekday by hour heatmaps, the average has no cells for "all"
+	WeeklyClock heatmapTemplateData
+	WeeklyAvg   heatmapTemplateData
+	PagingData  datebarTemplateData
 }
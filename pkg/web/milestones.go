@@ -0,0 +1,65 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// number of recent artist milestones and artist projections shown
+const milestoneLimit = 10
+
+// milestones finds the milestones reached so far, see query.FindMilestones
+func (app *Application) milestones(tz *time.Location, limit int) (query.Milestones, error) {
+	key := fmt.Sprintf("milestones %s %s %d", tz, app.today(tz), limit)
+	res, err := app.cachedStats(key, func() (interface{}, error) {
+		return query.FindMilestones(app.db.SQL, app.now(), tz, limit)
+	})
+	if err != nil {
+		return query.Milestones{}, err
+	}
+	return res.(query.Milestones), nil
+}
+
+func (app *Application) milestonesPage(w http.ResponseWriter, r *http.Request) {
+
+	milestones, err := app.milestones(app.sessionTimezone(r), milestoneLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	type milestonesTemplateData struct {
+		Milestones query.Milestones
+		PaceDays   int
+	}
+
+	app.renderTemplate(w, "milestones.tmpl", milestonesTemplateData{
+		Milestones: milestones,
+		PaceDays:   query.MilestonePaceDays,
+	})
+}
+
+func (app *Application) milestonesData(w http.ResponseWriter, r *http.Request) {
+
+	limit := milestoneLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid value for parameter: limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	milestones, err := app.milestones(app.sessionTimezone(r), limit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, milestones)
+}
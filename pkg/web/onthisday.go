@@ -0,0 +1,68 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// loadOnThisDay collects the history for the date parameter, or
+// today if it isn't given, writing an error response and returning
+// false if it can't
+func (app *Application) loadOnThisDay(w http.ResponseWriter, r *http.Request) (time.Time, []query.DayHistory, bool) {
+	tz := app.sessionTimezone(r)
+
+	day := app.now().In(tz)
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		var err error
+		day, err = time.ParseInLocation("2006-01-02", dateStr, tz)
+		if err != nil {
+			http.Error(w, "invalid format for parameter: date", http.StatusBadRequest)
+			return day, nil, false
+		}
+	}
+
+	history, err := query.OnThisDay(app.db.SQL, day, tz, app.sessionGap(r))
+	if err != nil {
+		app.serverError(w, err)
+		return day, nil, false
+	}
+	return day, history, true
+}
+
+// onThisDayPage shows what was played on today's date in earlier years
+func (app *Application) onThisDayPage(w http.ResponseWriter, r *http.Request) {
+	day, history, ok := app.loadOnThisDay(w, r)
+	if !ok {
+		return
+	}
+
+	type onThisDayTemplateData struct {
+		Date    time.Time
+		History []query.DayHistory
+	}
+
+	app.renderTemplate(w, "onthisday.tmpl", onThisDayTemplateData{
+		Date:    day,
+		History: history,
+	})
+}
+
+// onThisDayData is the same as onThisDayPage, for a morning digest
+func (app *Application) onThisDayData(w http.ResponseWriter, r *http.Request) {
+	day, history, ok := app.loadOnThisDay(w, r)
+	if !ok {
+		return
+	}
+
+	type onThisDayResponse struct {
+		Date    string             `json:"date"`
+		History []query.DayHistory `json:"history"`
+	}
+
+	renderJSON(w, http.StatusOK, onThisDayResponse{
+		Date:    day.Format("2006-01-02"),
+		History: history,
+	})
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// all-time chart records, and where each artist has placed
+// in the weekly, monthly and yearly charts
+
+// number of artists in each chart record list
+const chartRecordLimit = 10
+
+// chartHistoryCache keeps a chart history for each timezone and week
+// start, since working one out means scanning every play
+type chartHistoryCache struct {
+	sync.Mutex
+	histories map[string]query.ChartHistory
+}
+
+// chartHistory returns the chart history for the current user's
+// timezone and week start, recomputing it if the activity has changed
+func (app *Application) chartHistory(r *http.Request) (query.ChartHistory, error) {
+	tz := app.sessionTimezone(r)
+	weekStart := app.sessionWeekStart(r)
+	key := tz.String() + " " + weekStart.String()
+
+	version, err := query.CurrentActivityVersion(app.db.SQL)
+	if err != nil {
+		return query.ChartHistory{}, err
+	}
+
+	app.chartHistories.Lock()
+	defer app.chartHistories.Unlock()
+
+	if history, ok := app.chartHistories.histories[key]; ok && history.Version == version {
+		return history, nil
+	}
+
+	history, err := query.NewChartHistory(app.db.SQL, tz, weekStart)
+	if err != nil {
+		return history, err
+	}
+	if app.chartHistories.histories == nil {
+		app.chartHistories.histories = map[string]query.ChartHistory{}
+	}
+	app.chartHistories.histories[key] = history
+	return history, nil
+}
+
+func (app *Application) recordsPage(w http.ResponseWriter, r *http.Request) {
+
+	history, err := app.chartHistory(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	type recordList struct {
+		Title   string
+		Unit    string
+		Records []query.ChartRecord
+	}
+
+	type recordsTemplateData struct {
+		Weekly  []recordList
+		Monthly []recordList
+		Yearly  []recordList
+	}
+
+	records := history.Records(chartRecordLimit)
+	app.renderTemplate(w, "records.tmpl", recordsTemplateData{
+		Weekly: []recordList{
+			{"Most Weeks at #1", "weeks", records.WeeksAtOne},
+			{"Longest Run at #1", "weeks", records.LongestWeeksRun},
+			{"Most Weeks in the Top 10", "weeks", records.WeeksInTopTen},
+		},
+		Monthly: []recordList{
+			{"Most Months at #1", "months", records.MonthsAtOne},
+			{"Longest Run at #1", "months", records.LongestMonthsRun},
+			{"Most Months in the Top 10", "months", records.MonthsInTopTen},
+		},
+		Yearly: []recordList{
+			{"Most Years at #1", "years", records.YearsAtOne},
+			{"Most Years in the Top 10", "years", records.YearsInTopTen},
+		},
+	})
+}
+
+func (app *Application) chartRecordsData(w http.ResponseWriter, r *http.Request) {
+
+	limit := chartRecordLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid value for parameter: limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, err := app.chartHistory(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, history.Records(limit))
+}
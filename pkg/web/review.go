@@ -0,0 +1,80 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// loadYearReview reviews the year in yearStr, or the current year if
+// it's empty, writing an error response and returning false if it can't
+func (app *Application) loadYearReview(w http.ResponseWriter, r *http.Request, yearStr string) (query.YearReviewResult, bool) {
+	tz := app.sessionTimezone(r)
+
+	year := app.now().In(tz).Year()
+	if yearStr != "" {
+		var err error
+		year, err = strconv.Atoi(yearStr)
+		if err != nil {
+			http.Error(w, "invalid format for parameter: year", http.StatusBadRequest)
+			return query.YearReviewResult{}, false
+		}
+	}
+
+	review, err := app.yearReview(year, tz, app.sessionGap(r))
+	if err != nil {
+		app.serverError(w, err)
+		return review, false
+	}
+	return review, true
+}
+
+// yearReview reviews a calendar year, see query.YearReview. Past years
+// only change with the activity, the current one changes every day too
+func (app *Application) yearReview(year int, tz *time.Location, gap time.Duration) (query.YearReviewResult, error) {
+	key := fmt.Sprintf("review %d %s %d", year, tz, gap)
+	if year >= app.now().In(tz).Year() {
+		key += " " + app.today(tz)
+	}
+	res, err := app.cachedStats(key, func() (interface{}, error) {
+		return query.YearReview(app.db.SQL, year, tz, gap)
+	})
+	if err != nil {
+		return query.YearReviewResult{}, err
+	}
+	return res.(query.YearReviewResult), nil
+}
+
+// reviewPage is a printable review of the year at /review/{year}
+func (app *Application) reviewPage(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.loadYearReview(w, r, strings.TrimPrefix(r.URL.Path, "/review/"))
+	if !ok {
+		return
+	}
+
+	type reviewTemplateData struct {
+		Review       query.YearReviewResult
+		PreviousYear int
+		NextYear     int // zero if the next year hasn't started
+	}
+
+	dat := reviewTemplateData{Review: review, PreviousYear: review.Year - 1}
+	if review.Year < app.now().In(app.sessionTimezone(r)).Year() {
+		dat.NextYear = review.Year + 1
+	}
+
+	app.renderTemplate(w, "review.tmpl", dat)
+}
+
+func (app *Application) reviewData(w http.ResponseWriter, r *http.Request) {
+	review, ok := app.loadYearReview(w, r, r.URL.Query().Get("year"))
+	if !ok {
+		return
+	}
+
+	renderJSON(w, http.StatusOK, review)
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// listening sessions
+
+// longest date range in days that sessions are listed for. Finding
+// sessions needs every play in the range, which is too many for years
+const maxSessionDays = 92
+
+// sessionRangeTooLong is whether a date range has
+// too many plays to split into sessions
+func sessionRangeTooLong(params query.DateRangeParams) bool {
+	return params.Mode == "all" || params.Days() > maxSessionDays
+}
+
+// sessionGap returns the longest break between plays in the same
+// listening session, chosen on the settings page
+func (app *Application) sessionGap(r *http.Request) time.Duration {
+	minutes := app.session.GetInt(r, "sessionGap")
+	if minutes <= 0 {
+		return query.DefaultSessionGap
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// extractSessionGap reads an optional gap parameter in minutes,
+// falling back to the one in the session
+func (app *Application) extractSessionGap(r *http.Request) (time.Duration, error) {
+	gapStr := r.URL.Query().Get("gap")
+	if gapStr == "" {
+		return app.sessionGap(r), nil
+	}
+	minutes, err := strconv.Atoi(gapStr)
+	if err != nil || minutes <= 0 {
+		return 0, errors.New("invalid value for parameter: gap")
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+func (app *Application) sessionsPage(w http.ResponseWriter, r *http.Request, templateName string) {
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	gap := app.sessionGap(r)
+	tooLong := sessionRangeTooLong(params)
+	var sessions []query.Session
+	if !tooLong {
+		sessions, err = query.Sessions(app.db.SQL, params, gap)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	type sessionsTemplateData struct {
+		Sessions   []query.Session
+		Stats      query.SessionStats
+		GapMinutes int
+		TooLong    bool
+		MaxDays    int
+		PagingData datebarTemplateData
+	}
+
+	dat := sessionsTemplateData{
+		Sessions:   sessions,
+		Stats:      query.SummarizeSessions(sessions),
+		GapMinutes: int(gap.Minutes()),
+		TooLong:    tooLong,
+		MaxDays:    maxSessionDays,
+		PagingData: app.dateRangeBar(params, "Listening Sessions", "/htmx/sessions", "#sessions-pagegrid"),
+	}
+
+	app.renderTemplate(w, templateName, dat)
+}
+
+func (app *Application) sessionsData(w http.ResponseWriter, r *http.Request) {
+
+	type sessionsResponse struct {
+		Mode       string             `json:"mode"`
+		StartDate  time.Time          `json:"startDate"`
+		EndDate    time.Time          `json:"endDate"`
+		GapMinutes int                `json:"gap"`
+		Stats      query.SessionStats `json:"stats"`
+		Sessions   []query.Session    `json:"sessions"`
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sessionRangeTooLong(params) {
+		http.Error(w, fmt.Sprintf("sessions can't be listed for more than %d days", maxSessionDays),
+			http.StatusBadRequest)
+		return
+	}
+	gap, err := app.extractSessionGap(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := query.Sessions(app.db.SQL, params, gap)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, sessionsResponse{
+		Mode:       params.Mode,
+		StartDate:  params.Start,
+		EndDate:    params.End,
+		GapMinutes: int(gap.Minutes()),
+		Stats:      query.SummarizeSessions(sessions),
+		Sessions:   sessions,
+	})
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	m "bitbucket.org/grgbrn/localfm/pkg/model"
+)
+
+// settings.tmpl
+type settingsTemplateData struct {
+	Exclusions     []m.Exclusion
+	ExclusionKinds []string
+	WeekStart      time.Weekday
+	Weekdays       []time.Weekday
+	SessionGap     int // minutes
+	Error          string
+}
+
+// settingsPage shows the exclusion list and display preferences, and
+// handles form posts that change them. The exclusion list is shared by
+// everyone, preferences are kept in the session like the timezone
+func (app *Application) settingsPage(w http.ResponseWriter, r *http.Request) {
+	var formError string
+
+	if r.Method == "POST" {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.PostForm.Get("action") {
+		case "addExclusion":
+			_, err = app.db.AddExclusion(r.PostForm.Get("kind"), r.PostForm.Get("pattern"))
+		case "removeExclusion":
+			var id int64
+			id, err = strconv.ParseInt(r.PostForm.Get("id"), 10, 64)
+			if err == nil {
+				err = app.db.RemoveExclusion(id)
+			}
+		case "setWeekStart":
+			day, convErr := strconv.Atoi(r.PostForm.Get("weekStart"))
+			if convErr != nil || day < int(time.Sunday) || day > int(time.Saturday) {
+				http.Error(w, "invalid value for parameter: weekStart", http.StatusBadRequest)
+				return
+			}
+			app.session.Put(r, "weekStart", time.Weekday(day).String())
+		case "setSessionGap":
+			minutes, convErr := strconv.Atoi(r.PostForm.Get("sessionGap"))
+			if convErr != nil || minutes <= 0 {
+				http.Error(w, "invalid value for parameter: sessionGap", http.StatusBadRequest)
+				return
+			}
+			app.session.Put(r, "sessionGap", minutes)
+		default:
+			http.Error(w, "invalid value for parameter: action", http.StatusBadRequest)
+			return
+		}
+
+		if err == nil {
+			// redirect so a reload doesn't resubmit the form
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+		formError = err.Error()
+	} else if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	exclusions, err := app.db.ListExclusions()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var weekdays []time.Weekday
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays = append(weekdays, d)
+	}
+
+	app.renderTemplate(w, "settings.tmpl", settingsTemplateData{
+		Exclusions:     exclusions,
+		ExclusionKinds: m.ExclusionKinds,
+		WeekStart:      app.sessionWeekStart(r),
+		Weekdays:       weekdays,
+		SessionGap:     int(app.sessionGap(r).Minutes()),
+		Error:          formError,
+	})
+}
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// months with similar taste, and how taste has drifted year to year
+
+// number of similar months listed
+const similarMonthLimit = 10
+
+// similarity matrix geometry, in svg units
+const (
+	similarityCell = 24
+	similarityStep = 26
+)
+
+// buildSimilarityHeatmap lays out a year by year similarity matrix.
+// Shades are stretched from the least similar pair of years up to 1,
+// since years are usually more alike than not
+func buildSimilarityHeatmap(matrix query.SimilarityMatrix) heatmapTemplateData {
+	n := len(matrix.Years)
+	hm := heatmapTemplateData{
+		CellSize: similarityCell,
+		Width:    heatmapLeft + n*similarityStep,
+		Height:   heatmapTop + n*similarityStep,
+	}
+
+	least := 1.0
+	for _, row := range matrix.Similarity {
+		for _, sim := range row {
+			least = math.Min(least, sim)
+		}
+	}
+
+	for i, row := range matrix.Similarity {
+		y := heatmapTop + i*similarityStep
+		for j, sim := range row {
+			level := heatmapLevels
+			if least < 1 {
+				level = heatLevel(1+int(math.Round((sim-least)/(1-least)*99)), 100)
+			}
+			hm.Cells = append(hm.Cells, heatmapCellData{
+				X:     heatmapLeft + j*similarityStep,
+				Y:     y,
+				Level: level,
+				Title: fmt.Sprintf("%d and %d: %.2f", matrix.Years[i], matrix.Years[j], sim),
+			})
+		}
+		label := strconv.Itoa(matrix.Years[i])
+		hm.RowLabels = append(hm.RowLabels, heatmapLabelData{X: 0, Y: y + similarityCell/2 + 3, Text: label})
+		hm.ColumnLabels = append(hm.ColumnLabels, heatmapLabelData{X: heatmapLeft + i*similarityStep, Y: heatmapTop - 4, Text: label})
+	}
+	return hm
+}
+
+// similarMonth parses the month parameter, formatted as 2006-01,
+// defaulting to the current month
+func (app *Application) similarMonth(r *http.Request, tz *time.Location) (time.Time, error) {
+	now := app.now().In(tz)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, tz)
+	if monthStr := r.URL.Query().Get("month"); monthStr != "" {
+		var err error
+		month, err = time.ParseInLocation("2006-01", monthStr, tz)
+		if err != nil {
+			return month, errors.New("invalid format for parameter: month")
+		}
+	}
+	return month, nil
+}
+
+func (app *Application) similarityPage(w http.ResponseWriter, r *http.Request) {
+	tz := app.sessionTimezone(r)
+
+	month, err := app.similarMonth(r, tz)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	months, err := app.artistsByMonth(tz)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	similar := query.SimilarMonths(months, month, similarMonthLimit)
+	matrix := query.YearSimilarity(months, app.now())
+
+	type similarMonthData struct {
+		query.SimilarPeriod
+		// first and last day, for a custom date range
+		StartDate, EndDate string
+	}
+
+	type similarityTemplateData struct {
+		Month         time.Time
+		PreviousMonth string
+		NextMonth     string // empty for the current month
+		Similar       []similarMonthData
+		Matrix        query.SimilarityMatrix
+		Heatmap       heatmapTemplateData
+	}
+
+	dat := similarityTemplateData{
+		Month:         month,
+		PreviousMonth: month.AddDate(0, -1, 0).Format("2006-01"),
+		Matrix:        matrix,
+		Heatmap:       buildSimilarityHeatmap(matrix),
+	}
+	if next := month.AddDate(0, 1, 0); next.Before(app.now()) {
+		dat.NextMonth = next.Format("2006-01")
+	}
+	for _, s := range similar {
+		dat.Similar = append(dat.Similar, similarMonthData{
+			SimilarPeriod: s,
+			StartDate:     s.Start.Format("2006-01-02"),
+			EndDate:       s.Start.AddDate(0, 1, -1).Format("2006-01-02"),
+		})
+	}
+
+	app.renderTemplate(w, "similarity.tmpl", dat)
+}
+
+func (app *Application) similarityData(w http.ResponseWriter, r *http.Request) {
+	tz := app.sessionTimezone(r)
+
+	type similarityResponse struct {
+		Month   string                 `json:"month"`
+		Similar []query.SimilarPeriod  `json:"similar"`
+		Years   query.SimilarityMatrix `json:"years"`
+	}
+
+	month, err := app.similarMonth(r, tz)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	months, err := app.artistsByMonth(tz)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	similar := query.SimilarMonths(months, month, similarMonthLimit)
+	matrix := query.YearSimilarity(months, app.now())
+
+	renderJSON(w, http.StatusOK, similarityResponse{
+		Month:   month.Format("2006-01"),
+		Similar: similar,
+		Years:   matrix,
+	})
+}
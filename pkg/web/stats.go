@@ -0,0 +1,379 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"bitbucket.org/grgbrn/localfm/pkg/query"
+)
+
+// listening statistics that aren't charts of tracks or artists
+
+// number of artists in the artist streak list
+const streakArtistLimit = 10
+
+// number of months in the diversity chart, ending with
+// the selected date range
+const diversityMonths = 24
+
+// number of periods shown in the consistency history,
+// including the current one
+const consistencyPeriods = 6
+
+// most results kept in the stats cache, it's
+// emptied when it gets any bigger
+const statsCacheSize = 256
+
+// statsCache keeps statistics that take a scan of all (or years of) the
+// activity, like chartHistoryCache, until the ActivityVersion changes.
+// Only one request works out each result, the others wait for it
+type statsCache struct {
+	sync.Mutex
+	version query.ActivityVersion
+	results map[string]interface{}
+	pending map[string]*statsCall
+}
+
+// statsCall is a result that's being worked out,
+// done is closed when it's ready
+type statsCall struct {
+	done chan struct{}
+	res  interface{}
+	err  error
+}
+
+// cachedStats returns the result stored under key, calling compute to
+// work it out if there isn't one or the activity has changed since. The
+// key has to include everything the result depends on. Results that
+// depend on the time only change once a day, so they're keyed by today.
+// The cache isn't locked while computing, so a slow result only holds
+// up requests for the same key
+func (app *Application) cachedStats(key string, compute func() (interface{}, error)) (interface{}, error) {
+	version, err := query.CurrentActivityVersion(app.db.SQL)
+	if err != nil {
+		return nil, err
+	}
+
+	app.stats.Lock()
+	if app.stats.results == nil || app.stats.version != version ||
+		len(app.stats.results) >= statsCacheSize {
+		app.stats.results = map[string]interface{}{}
+		app.stats.pending = map[string]*statsCall{}
+		app.stats.version = version
+	}
+	if res, ok := app.stats.results[key]; ok {
+		app.stats.Unlock()
+		return res, nil
+	}
+	if call, ok := app.stats.pending[key]; ok {
+		app.stats.Unlock()
+		<-call.done
+		return call.res, call.err
+	}
+	call := &statsCall{done: make(chan struct{})}
+	app.stats.pending[key] = call
+	app.stats.Unlock()
+
+	call.res, call.err = compute()
+
+	app.stats.Lock()
+	// the cache may have been emptied in the meantime
+	if app.stats.pending[key] == call {
+		delete(app.stats.pending, key)
+		if call.err == nil {
+			app.stats.results[key] = call.res
+		}
+	}
+	app.stats.Unlock()
+	close(call.done)
+
+	return call.res, call.err
+}
+
+// today is the current date in tz, for stats cache keys
+func (app *Application) today(tz *time.Location) string {
+	return app.now().In(tz).Format("2006-01-02")
+}
+
+// streaks finds the listening streaks in tz, see query.Streaks
+func (app *Application) streaks(tz *time.Location, limit int) (query.StreakStats, error) {
+	key := fmt.Sprintf("streaks %s %s %d", tz, app.today(tz), limit)
+	res, err := app.cachedStats(key, func() (interface{}, error) {
+		return query.Streaks(app.db.SQL, tz, app.now(), limit)
+	})
+	if err != nil {
+		return query.StreakStats{}, err
+	}
+	return res.(query.StreakStats), nil
+}
+
+// forgottenFavorites finds the forgotten favorites,
+// see query.FindForgottenFavorites
+func (app *Application) forgottenFavorites(params query.ForgottenParams) (query.ForgottenFavorites, error) {
+	day := params.Now.In(params.TZ).Format("2006-01-02")
+	key := fmt.Sprintf("forgotten %s %s %d %d %d %d", params.TZ, day,
+		params.Months, params.MaxRecent, params.MinPeak, params.Limit)
+	res, err := app.cachedStats(key, func() (interface{}, error) {
+		return query.FindForgottenFavorites(app.db.SQL, params)
+	})
+	if err != nil {
+		return query.ForgottenFavorites{}, err
+	}
+	return res.(query.ForgottenFavorites), nil
+}
+
+// monthlyDiversity measures diversity per month,
+// see query.MonthlyDiversity
+func (app *Application) monthlyDiversity(start, end time.Time, tz *time.Location) ([]query.DiversityResult, error) {
+	key := fmt.Sprintf("diversity %s %d %d", tz, start.Unix(), end.Unix())
+	res, err := app.cachedStats(key, func() (interface{}, error) {
+		return query.MonthlyDiversity(app.db.SQL, start, end, tz)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]query.DiversityResult), nil
+}
+
+// artistsByMonth counts plays per artist per month,
+// see query.ArtistsByMonth
+func (app *Application) artistsByMonth(tz *time.Location) (query.MonthlyArtists, error) {
+	res, err := app.cachedStats(fmt.Sprintf("artists by month %s", tz), func() (interface{}, error) {
+		return query.ArtistsByMonth(app.db.SQL, tz)
+	})
+	if err != nil {
+		return query.MonthlyArtists{}, err
+	}
+	return res.(query.MonthlyArtists), nil
+}
+
+// periodConsistency is the consistency score of one period
+type periodConsistency struct {
+	Title string
+	query.ConsistencyResult
+}
+
+// consistencyHistory scores the selected period and the ones before it,
+// newest first. "all" has nothing before it
+func (app *Application) consistencyHistory(params query.DateRangeParams) ([]periodConsistency, error) {
+	key := fmt.Sprintf("consistency %s %s %d %d %s", params.TZ, params.Mode,
+		params.Start.Unix(), params.End.Unix(), app.today(params.TZ))
+	res, err := app.cachedStats(key, func() (interface{}, error) {
+		var history []periodConsistency
+
+		periods := consistencyPeriods
+		if params.Mode == "all" {
+			periods = 1
+		}
+
+		for i := 0; i < periods; i++ {
+			p := params.Shift(i)
+			res, err := query.Consistency(app.db.SQL, p, app.now())
+			if err != nil {
+				return history, err
+			}
+			history = append(history, periodConsistency{Title: dateRangeTitle(p), ConsistencyResult: res})
+		}
+		return history, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]periodConsistency), nil
+}
+
+func (app *Application) statsPage(w http.ResponseWriter, r *http.Request, templateName string) {
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	streaks, err := app.streaks(params.TZ, streakArtistLimit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	consistency, err := app.consistencyHistory(params)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	forgottenParams := query.NewForgottenParams(app.now(), params.TZ)
+	forgotten, err := app.forgottenFavorites(forgottenParams)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	diversity, err := query.Diversity(app.db.SQL, params)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	diversitySeries, err := app.monthlyDiversity(
+		params.End.AddDate(0, -diversityMonths, 0), params.End, params.TZ)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	type statsTemplateData struct {
+		Streaks         query.StreakStats
+		Consistency     []periodConsistency
+		Diversity       query.DiversityResult
+		DiversitySeries []query.DiversityResult
+		Forgotten       query.ForgottenFavorites
+		// not affected by the date range
+		ForgottenParams query.ForgottenParams
+		PagingData      datebarTemplateData
+	}
+
+	dat := statsTemplateData{
+		Streaks:         streaks,
+		Consistency:     consistency,
+		Diversity:       diversity,
+		DiversitySeries: diversitySeries,
+		Forgotten:       forgotten,
+		ForgottenParams: forgottenParams,
+		PagingData:      app.dateRangeBar(params, "Listening Stats", "/htmx/stats", "#stats-pagegrid"),
+	}
+
+	app.renderTemplate(w, templateName, dat)
+}
+
+func (app *Application) streaksData(w http.ResponseWriter, r *http.Request) {
+
+	limit := streakArtistLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid value for parameter: limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	streaks, err := app.streaks(app.sessionTimezone(r), limit)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, streaks)
+}
+
+func (app *Application) consistencyData(w http.ResponseWriter, r *http.Request) {
+
+	type consistencyResponse struct {
+		Mode      string    `json:"mode"`
+		StartDate time.Time `json:"startDate"`
+		EndDate   time.Time `json:"endDate"`
+		query.ConsistencyResult
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := query.Consistency(app.db.SQL, params, app.now())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, consistencyResponse{
+		Mode:              params.Mode,
+		StartDate:         params.Start,
+		EndDate:           params.End,
+		ConsistencyResult: res,
+	})
+}
+
+// extractForgottenParams reads optional months, maxRecent, minPeak
+// and limit parameters over the defaults
+func (app *Application) extractForgottenParams(r *http.Request) (query.ForgottenParams, error) {
+	params := query.NewForgottenParams(app.now(), app.sessionTimezone(r))
+
+	for name, field := range map[string]*int{
+		"months":    &params.Months,
+		"maxRecent": &params.MaxRecent,
+		"minPeak":   &params.MinPeak,
+		"limit":     &params.Limit,
+	} {
+		str := r.URL.Query().Get(name)
+		if str == "" {
+			continue
+		}
+		val, err := strconv.Atoi(str)
+		if err != nil || val < 0 {
+			return params, errors.New("invalid value for parameter: " + name)
+		}
+		*field = val
+	}
+	return params, nil
+}
+
+func (app *Application) forgottenData(w http.ResponseWriter, r *http.Request) {
+
+	params, err := app.extractForgottenParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	forgotten, err := app.forgottenFavorites(params)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, forgotten)
+}
+
+func (app *Application) diversityData(w http.ResponseWriter, r *http.Request) {
+
+	type diversityResponse struct {
+		Mode      string                  `json:"mode"`
+		StartDate time.Time               `json:"startDate"`
+		EndDate   time.Time               `json:"endDate"`
+		Diversity query.DiversityResult   `json:"diversity"`
+		Monthly   []query.DiversityResult `json:"monthly"`
+	}
+
+	params, err := app.extractDateRangeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	diversity, err := query.Diversity(app.db.SQL, params)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	monthly, err := app.monthlyDiversity(params.Start, params.End, params.TZ)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	renderJSON(w, http.StatusOK, diversityResponse{
+		Mode:      params.Mode,
+		StartDate: params.Start,
+		EndDate:   params.End,
+		Diversity: diversity,
+		Monthly:   monthly,
+	})
+}
@@ -28,6 +28,8 @@ func newTemplateCache() (map[string]*template.Template, error) {
 	var functions = template.FuncMap{
 		"dateLabel":  dateLabel,
 		"prettyTime": prettyTime,
+		"percent":    percent,
+		"change":     change,
 	}
 
 	for _, page := range pages {
@@ -87,3 +89,16 @@ func prettyTime(t time.Time) string {
 
 	return t.Format(time.Kitchen)
 }
+
+// formats a fraction as a whole percentage
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
+
+// formats the change from before to now as a signed percentage
+func change(now, before int) string {
+	if before == 0 {
+		return "new"
+	}
+	return fmt.Sprintf("%+.0f%%", float64(now-before)/float64(before)*100)
+}
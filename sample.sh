@@ -13,32 +13,10 @@ if [ ! -f "$DBNAME" ]; then
     exit 1
 fi
 
-# figure out what shell command to use for checksums
-SHACMD=""
-case $(uname) in
-    "Darwin") SHACMD="shasum";;
-    "Linux") SHACMD="sha1sum";;
-esac
+# snapshot the database before updating, keeping the last 7
+# snapshots. uses sqlite's backup api so it's safe to run even
+# while the web server is writing to the database
+mkdir -p backups
+./localfm backup -dir backups -keep 7 || exit 1
 
-if [ SHACMD == "" ]; then
-    echo "error! can't find shasum command"
-    exit 1
-fi
-
-# backup the existing database only if no backup exists
-# or if a backup exists and differs from the current db
-DB_BACKUP="${DBNAME}.prev"
-if [ ! -f "$DB_BACKUP" ]; then
-    echo "creating initial backup"
-    cp $DBNAME $DB_BACKUP
-else
-    OLD=$($SHACMD $DB_BACKUP | awk '{print $1}')
-    NEW=$($SHACMD $DBNAME | awk '{print $1}')
-
-    if [ "$OLD" != "$NEW" ]; then
-        echo "rotating backups"
-        cp $DBNAME $DB_BACKUP
-    fi
-fi
-
-./localfm
+./update
@@ -1,3 +1,7 @@
+-- initial schema for a new database. tables added later on are
+-- created by the migrations in pkg/model/migrate.go, which run
+-- automatically whenever the database is opened
+
 CREATE TABLE activity (
 	id INTEGER NOT NULL,
 
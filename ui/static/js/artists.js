@@ -0,0 +1,148 @@
+// charts for the artists page
+
+const artistColors = [
+    '#4e79a7', '#f28e2b', '#e15759', '#76b7b2', '#59a14f',
+    '#edc948', '#b07aa1', '#ff9da7', '#9c755f', '#bab0ac',
+];
+
+// "2023-01-01T00:00:00-05:00" => "2023-01" for months, "2023-01-01" for weeks
+function periodLabels(series) {
+    let width = series.interval == 'month' ? 7 : 10;
+    return series.periods.map(x => x.substring(0, width));
+}
+
+window.drawArtistShareChart = function (series) {
+    // series corresponds to ArtistTimeSeriesResult struct in golang
+    // attributes: interval, cumulative, periods, artists (artist, counts)
+    new Chart(document.getElementById('artistShareChart'), {
+        type: 'line',
+        data: {
+            labels: periodLabels(series),
+            datasets: series.artists.map((a, i) => ({
+                label: a.artist,
+                data: a.counts,
+                borderColor: artistColors[i % artistColors.length],
+                backgroundColor: artistColors[i % artistColors.length],
+                fill: true,
+                pointRadius: 0,
+            }))
+        },
+        options: {
+            responsive: true,
+            interaction: {
+                mode: 'index',
+                intersect: false,
+            },
+            scales: {
+                y: {
+                    stacked: true,
+                    title: {
+                        display: true,
+                        text: "Tracks Played"
+                    }
+                }
+            },
+            plugins: {
+                title: {
+                    display: true,
+                    text: `Top artists per ${series.interval}`,
+                }
+            }
+        }
+    });
+}
+
+// the race timer outlives the page content when htmx swaps it out
+let raceTimer = null;
+
+window.drawArtistRace = function (series) {
+    // series is a cumulative ArtistTimeSeriesResult
+    clearInterval(raceTimer);
+
+    let labels = periodLabels(series);
+    let slider = document.getElementById('raceSlider');
+    let button = document.getElementById('raceButton');
+    let label = document.getElementById('raceLabel');
+    let last = series.periods.length - 1;
+
+    // fix the scale to the final totals so bars grow as the race runs
+    let max = Math.max(0, ...series.artists.map(a => a.counts[last]));
+
+    let chart = new Chart(document.getElementById('artistRaceChart'), {
+        type: 'bar',
+        data: {
+            labels: [],
+            datasets: [{
+                label: 'Total plays',
+                data: [],
+                backgroundColor: [],
+            }]
+        },
+        options: {
+            indexAxis: 'y',
+            responsive: true,
+            animation: {
+                duration: 300,
+            },
+            scales: {
+                x: {
+                    min: 0,
+                    max: max,
+                }
+            },
+            plugins: {
+                legend: {
+                    display: false,
+                }
+            }
+        }
+    });
+
+    let showPeriod = function (p) {
+        let ranked = series.artists
+            .map((a, i) => ({ name: a.artist, count: a.counts[p], color: artistColors[i % artistColors.length] }))
+            .sort((a, b) => b.count - a.count);
+
+        chart.data.labels = ranked.map(x => x.name);
+        chart.data.datasets[0].data = ranked.map(x => x.count);
+        chart.data.datasets[0].backgroundColor = ranked.map(x => x.color);
+        chart.update();
+
+        slider.value = p;
+        label.textContent = labels[p];
+    };
+
+    let stop = function () {
+        clearInterval(raceTimer);
+        raceTimer = null;
+        button.textContent = 'Play';
+    };
+
+    slider.max = last;
+    slider.oninput = function () {
+        stop();
+        showPeriod(Number(slider.value));
+    };
+
+    button.onclick = function () {
+        if (raceTimer) {
+            stop();
+            return;
+        }
+        let p = Number(slider.value);
+        if (p >= last) {
+            p = 0;
+            showPeriod(p);
+        }
+        button.textContent = 'Pause';
+        raceTimer = setInterval(function () {
+            p++;
+            showPeriod(p);
+            if (p >= last) {
+                stop();
+            }
+        }, 600);
+    };
+
+    showPeriod(last);
+}
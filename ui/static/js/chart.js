@@ -13,22 +13,28 @@ window.refreshListeningChart = function (clockData) {
         return s
     });
 
+    let datasets = [{
+        label: 'Scrobbles',
+        data: clockData.currentValues,
+        backgroundColor: 'rgba(0,0,255,0.6)',
+        borderColor: 'blue',
+        fill: true,
+        tension: 0.4,
+    }];
+    // detail pages have nothing to average
+    if (clockData.avgValues.length > 0) {
+        datasets.push({
+            label: clockData.label,
+            data: clockData.avgValues,
+        });
+    }
+
     let chartDom = document.getElementById('myChart');
     var myChart = new Chart(chartDom, {
         type: 'line',
         data: {
             labels: labels,
-            datasets: [{
-                label: 'Scrobbles',
-                data: clockData.currentValues,
-                backgroundColor: 'rgba(0,0,255,0.6)',
-                borderColor: 'blue',
-                fill: true,
-                tension: 0.4,
-            }, {
-                label: clockData.label,
-                data: clockData.avgValues,
-            }]
+            datasets: datasets
         },
         options: {
             responsive: true,
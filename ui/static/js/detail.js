@@ -0,0 +1,61 @@
+// charts for the artist, album and track detail pages
+
+// "2023-01-01T00:00:00-05:00" => "2023-01"
+let monthLabel = x => x.start.substring(0, 7);
+
+window.drawMonthlyChart = function (monthly) {
+    // monthly is a list of PeriodCount structs from golang
+    // attributes: start, count
+    new Chart(document.getElementById('monthlyChart'), {
+        type: 'bar',
+        data: {
+            labels: monthly.map(monthLabel),
+            datasets: [{
+                label: 'Scrobbles',
+                data: monthly.map(x => x.count),
+                backgroundColor: 'rgba(0,0,255,0.6)',
+            }]
+        },
+        options: {
+            responsive: true,
+            plugins: {
+                title: {
+                    display: true,
+                    text: 'Plays per month',
+                }
+            }
+        }
+    });
+}
+
+window.drawRankChart = function (ranks) {
+    // ranks is a list of RankResult structs from golang
+    // attributes: start, rank, count
+    new Chart(document.getElementById('rankChart'), {
+        type: 'line',
+        data: {
+            labels: ranks.map(monthLabel),
+            datasets: [{
+                label: 'Rank',
+                data: ranks.map(x => x.rank),
+                borderColor: 'blue',
+            }]
+        },
+        options: {
+            responsive: true,
+            scales: {
+                y: {
+                    // #1 at the top
+                    reverse: true,
+                    min: 1,
+                }
+            },
+            plugins: {
+                title: {
+                    display: true,
+                    text: 'Monthly artist chart position',
+                }
+            }
+        }
+    });
+}
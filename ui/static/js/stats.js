@@ -0,0 +1,55 @@
+// charts for the stats page
+
+window.drawDiversityChart = function (series) {
+    // series is a list of DiversityResult structs from golang
+    // attributes: start, count, uniqueArtists, uniqueTracks,
+    // entropy, top10Share, gini
+    new Chart(document.getElementById('diversityChart'), {
+        type: 'line',
+        data: {
+            // "2023-01-01T00:00:00-05:00" => "2023-01"
+            labels: series.map(x => x.start.substring(0, 7)),
+            datasets: [{
+                label: 'Artist entropy (bits)',
+                data: series.map(x => x.entropy),
+                borderColor: 'blue',
+                yAxisID: 'bits',
+            }, {
+                label: 'Top 10 share',
+                data: series.map(x => x.top10Share),
+                borderColor: 'orange',
+                yAxisID: 'share',
+            }, {
+                label: 'Gini',
+                data: series.map(x => x.gini),
+                borderColor: 'green',
+                yAxisID: 'share',
+            }]
+        },
+        options: {
+            responsive: true,
+            scales: {
+                bits: {
+                    type: 'linear',
+                    position: 'left',
+                    min: 0,
+                },
+                share: {
+                    type: 'linear',
+                    position: 'right',
+                    min: 0,
+                    max: 1,
+                    grid: {
+                        drawOnChartArea: false,
+                    }
+                }
+            },
+            plugins: {
+                title: {
+                    display: true,
+                    text: 'Listening diversity per month',
+                }
+            }
+        }
+    });
+}